@@ -3,12 +3,14 @@ package main
 import (
 	"fmt"
 	"game-server/internal/server"
-	"log"
+	"log/slog"
+	"os"
 )
 
 func main() {
+	slog.SetDefault(server.NewLogger(os.Stderr))
 	server := server.NewServer()
-	log.Println("Starting server")
+	slog.Info("Starting server", "addr", server.Addr)
 	err := server.ListenAndServe()
 	if err != nil {
 		panic(fmt.Sprintf("cannot start server: %s", err))
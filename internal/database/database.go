@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"log/slog"
 	"strconv"
 	"time"
 
@@ -16,39 +16,68 @@ import (
 type Service interface {
 	Health() map[string]string
 	Close() error
-	StorePlayer(playerId, playerName string) error
-	StoreGameHistory(gameId, players, result string) error
-	UpdateGameResult(gameId, result string) error
+	StorePlayer(playerId, playerName string, joinedAt time.Time) error
+	StoreGameHistory(gameId, players, result string, startedAt time.Time) error
+	UpdateGameResult(gameId, result string, endedAt time.Time) error
+	UpdateGamePlayers(gameId, players string) error
+	StoreGameParticipant(gameId, playerId, playerName string, isBot bool, joinedAt time.Time) error
+	MarkParticipantAbandoned(gameId, playerId string, leftAt time.Time) error
+	CountAbandons(playerId string, since time.Time) (int, error)
+	StoreSanction(sanction Sanction) (int64, error)
+	LiftSanction(sanctionId int64, now time.Time) error
+	GetActiveSanctions(playerId string, now time.Time) ([]Sanction, error)
+	GetSanctions(playerId string) ([]Sanction, error)
+	StorePlayerMute(playerId, mutedPlayerId string, now time.Time) error
+	DeletePlayerMute(playerId, mutedPlayerId string) error
+	GetPlayerMutes(playerId string) ([]string, error)
+	StoreReport(report Report) (int64, error)
+	GetReports(status string) ([]Report, error)
+	ReviewReport(reportId int64, reviewedBy, resolution string, now time.Time) error
+	SendFriendRequest(playerId, friendId string, now time.Time) error
+	AcceptFriendRequest(playerId, friendId string, now time.Time) error
+	RemoveFriend(playerId, friendId string) error
+	BlockPlayer(playerId, blockedId string, now time.Time) error
+	GetFriends(playerId string) ([]Friend, error)
+	GetFriendIDs(playerId string) ([]string, error)
 	GetPlayerGames(playerId string) ([]map[string]interface{}, error)
+	RecordGameStats(gameId, mode string, results []PlayerResult, endedAt time.Time) error
+	GetPlayerProfile(playerId string) (*PlayerProfile, error)
+	GetRatings(leaderboard string, playerIds []string) (map[string]int, error)
+	UpdateRatings(leaderboard string, changes map[string]int, now time.Time) error
+	GetLeaderboard(leaderboard string, offset, limit int) ([]LeaderboardEntry, int, error)
+	GetLeaderboardPosition(leaderboard, playerId string) (int, error)
+	StartFirstSeason(now time.Time) error
+	CurrentSeason() (*Season, error)
+	EndSeason(nextName string, resetFactor float64, now time.Time) (*Season, error)
+	GetSeasons() ([]Season, error)
+	GetSeason(seasonId int64) (*Season, error)
+	GetSeasonStandings(seasonId int64, leaderboard string, offset, limit int) ([]LeaderboardEntry, int, error)
+	StoreGameResult(result GameResult) error
+	GetGameResult(gameId string) (*GameResult, error)
+	StoreReplay(gameId string, data []byte, now time.Time) error
+	GetReplay(gameId string) ([]byte, error)
 }
 
 type service struct {
-	db *sql.DB
+	db    *timedDB
+	dburl string
 }
 
-var (
-	dburl      = os.Getenv("DB_URL")
-	dbInstance *service
-)
-
-func New() Service {
-	// Reuse Connection
-	if dbInstance != nil {
-		return dbInstance
-	}
-
+// New opens the SQLite database at dburl and creates its tables. Every call opens its own
+// connection, so servers only share a database when they are given the same Service. The time
+// every query takes is reported to observe, which may be nil.
+func New(dburl string, observe QueryObserver) Service {
 	db, err := sql.Open("sqlite3", dburl)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	dbInstance = &service{
-		db: db,
-	}
-
 	createTables(db)
 
-	return dbInstance
+	return &service{
+		db:    &timedDB{DB: db, observe: observe},
+		dburl: dburl,
+	}
 }
 
 func createTables(db *sql.DB) {
@@ -68,6 +97,131 @@ func createTables(db *sql.DB) {
 		result TEXT
 	);`
 
+	// One row per player that took part in a game, bots are flagged so stats can exclude them
+	createGameParticipantsTable := `
+	CREATE TABLE IF NOT EXISTS game_participants (
+		game_id TEXT,
+		player_id TEXT,
+		name TEXT,
+		is_bot BOOLEAN,
+		joined_at DATETIME,
+		left_at DATETIME,
+		abandoned BOOLEAN DEFAULT 0,
+		PRIMARY KEY (game_id, player_id)
+	);`
+
+	createSanctionsTable := `
+	CREATE TABLE IF NOT EXISTS sanctions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		player_id TEXT,
+		type TEXT,
+		reason TEXT,
+		issued_by TEXT,
+		created_at DATETIME,
+		expires_at DATETIME,
+		lifted_at DATETIME
+	);`
+
+	createPlayerMutesTable := `
+	CREATE TABLE IF NOT EXISTS player_mutes (
+		player_id TEXT,
+		muted_player_id TEXT,
+		created_at DATETIME,
+		PRIMARY KEY (player_id, muted_player_id)
+	);`
+
+	createPlayerReportsTable := `
+	CREATE TABLE IF NOT EXISTS player_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		reporter_id TEXT,
+		reported_id TEXT,
+		game_id TEXT,
+		reason TEXT,
+		chat_context TEXT,
+		status TEXT,
+		created_at DATETIME,
+		reviewed_by TEXT,
+		reviewed_at DATETIME,
+		resolution TEXT
+	);`
+
+	createFriendshipsTable := `
+	CREATE TABLE IF NOT EXISTS friendships (
+		player_id TEXT,
+		friend_id TEXT,
+		status TEXT,
+		created_at DATETIME,
+		PRIMARY KEY (player_id, friend_id)
+	);`
+
+	// Lifetime stats per player and mode, placements are summed so averages stay exact
+	createPlayerStatsTable := `
+	CREATE TABLE IF NOT EXISTS player_stats (
+		player_id TEXT,
+		mode TEXT,
+		games_played INTEGER DEFAULT 0,
+		wins INTEGER DEFAULT 0,
+		losses INTEGER DEFAULT 0,
+		abandons INTEGER DEFAULT 0,
+		placed_games INTEGER DEFAULT 0,
+		placement_total INTEGER DEFAULT 0,
+		play_seconds INTEGER DEFAULT 0,
+		updated_at DATETIME,
+		PRIMARY KEY (player_id, mode)
+	);`
+
+	// Ratings of the current season per leaderboard, a mode or the global one
+	createPlayerRatingsTable := `
+	CREATE TABLE IF NOT EXISTS player_ratings (
+		leaderboard TEXT,
+		player_id TEXT,
+		rating INTEGER,
+		games INTEGER DEFAULT 0,
+		updated_at DATETIME,
+		PRIMARY KEY (leaderboard, player_id)
+	);
+	CREATE INDEX IF NOT EXISTS player_ratings_rank ON player_ratings (leaderboard, rating DESC, player_id);`
+
+	createSeasonsTable := `
+	CREATE TABLE IF NOT EXISTS seasons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT,
+		started_at DATETIME,
+		ended_at DATETIME
+	);`
+
+	// Final standings of ended seasons
+	createSeasonStandingsTable := `
+	CREATE TABLE IF NOT EXISTS season_standings (
+		season_id INTEGER,
+		leaderboard TEXT,
+		player_id TEXT,
+		rank INTEGER,
+		rating INTEGER,
+		games INTEGER,
+		PRIMARY KEY (season_id, leaderboard, player_id)
+	);`
+
+	// Structured results of finished games, the per player standings are stored as JSON
+	createGameResultsTable := `
+	CREATE TABLE IF NOT EXISTS game_results (
+		game_id TEXT PRIMARY KEY,
+		mode TEXT,
+		end_reason TEXT,
+		winner_team INTEGER,
+		winner_id TEXT,
+		players TEXT,
+		ended_at DATETIME
+	);`
+
+	// Gzipped replay streams of finished games
+	createReplaysTable := `
+	CREATE TABLE IF NOT EXISTS replays (
+		game_id TEXT PRIMARY KEY,
+		data BLOB,
+		created_at DATETIME
+	);`
+
 	_, err := db.Exec(createPlayersTable)
 	if err != nil {
 		log.Fatal("Failed to create players table:", err)
@@ -77,6 +231,61 @@ func createTables(db *sql.DB) {
 	if err != nil {
 		log.Fatal("Failed to create game history table:", err)
 	}
+
+	_, err = db.Exec(createGameParticipantsTable)
+	if err != nil {
+		log.Fatal("Failed to create game participants table:", err)
+	}
+
+	_, err = db.Exec(createSanctionsTable)
+	if err != nil {
+		log.Fatal("Failed to create sanctions table:", err)
+	}
+
+	_, err = db.Exec(createPlayerMutesTable)
+	if err != nil {
+		log.Fatal("Failed to create player mutes table:", err)
+	}
+
+	_, err = db.Exec(createPlayerReportsTable)
+	if err != nil {
+		log.Fatal("Failed to create player reports table:", err)
+	}
+
+	_, err = db.Exec(createFriendshipsTable)
+	if err != nil {
+		log.Fatal("Failed to create friendships table:", err)
+	}
+
+	_, err = db.Exec(createPlayerStatsTable)
+	if err != nil {
+		log.Fatal("Failed to create player stats table:", err)
+	}
+
+	_, err = db.Exec(createPlayerRatingsTable)
+	if err != nil {
+		log.Fatal("Failed to create player ratings table:", err)
+	}
+
+	_, err = db.Exec(createSeasonsTable)
+	if err != nil {
+		log.Fatal("Failed to create seasons table:", err)
+	}
+
+	_, err = db.Exec(createSeasonStandingsTable)
+	if err != nil {
+		log.Fatal("Failed to create season standings table:", err)
+	}
+
+	_, err = db.Exec(createGameResultsTable)
+	if err != nil {
+		log.Fatal("Failed to create game results table:", err)
+	}
+
+	_, err = db.Exec(createReplaysTable)
+	if err != nil {
+		log.Fatal("Failed to create replays table:", err)
+	}
 }
 
 func (s *service) Health() map[string]string {
@@ -125,30 +334,61 @@ func (s *service) Health() map[string]string {
 	return stats
 }
 
-func (s *service) StorePlayer(id string, Name string) error {
-	log.Printf("Creating user %s %s", id, Name)
+func (s *service) StorePlayer(id string, Name string, joinedAt time.Time) error {
+	slog.Info("Creating user", "player_id", id, "name", Name)
+	_, err := s.db.Exec(
+		`INSERT INTO players (player_id, name, joined_at) VALUES (?, ?, ?)`,
+		id, Name, sqliteTime(joinedAt))
+	return err
+}
+
+func (s *service) StoreGameHistory(gameID, players, result string, startedAt time.Time) error {
 	_, err := s.db.Exec(
-		`INSERT INTO players (player_id, name, joined_at) VALUES (?, ?, datetime('now'))`,
-		id, Name)
+		`INSERT INTO game_history (game_id, players, start_time, end_time, result) VALUES (?, ?, ?, NULL, ?)`,
+		gameID, players, sqliteTime(startedAt), result)
 	return err
 }
 
-func (s *service) StoreGameHistory(gameID, players, result string) error {
+func (s *service) UpdateGameResult(gameID, result string, endedAt time.Time) error {
 	_, err := s.db.Exec(
-		`INSERT INTO game_history (game_id, players, start_time, end_time, result) VALUES (?, ?, datetime('now'), NULL, ?)`,
-		gameID, players, result)
+		`UPDATE game_history SET end_time = ?, result = ? WHERE game_id = ?`,
+		sqliteTime(endedAt), result, gameID)
 	return err
 }
 
-func (s *service) UpdateGameResult(gameID, result string) error {
+func (s *service) UpdateGamePlayers(gameID, players string) error {
 	_, err := s.db.Exec(
-		`UPDATE game_history SET end_time = datetime('now'), result = ? WHERE game_id = ?`,
-		result, gameID)
+		`UPDATE game_history SET players = ? WHERE game_id = ?`,
+		players, gameID)
 	return err
 }
 
+func (s *service) StoreGameParticipant(gameID, playerID, playerName string, isBot bool, joinedAt time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO game_participants (game_id, player_id, name, is_bot, joined_at) VALUES (?, ?, ?, ?, ?)`,
+		gameID, playerID, playerName, isBot, sqliteTime(joinedAt))
+	return err
+}
+
+// MarkParticipantAbandoned records that the player left the game before it ended.
+func (s *service) MarkParticipantAbandoned(gameID, playerID string, leftAt time.Time) error {
+	_, err := s.db.Exec(
+		`UPDATE game_participants SET left_at = ?, abandoned = 1 WHERE game_id = ? AND player_id = ?`,
+		sqliteTime(leftAt), gameID, playerID)
+	return err
+}
+
+// CountAbandons returns how many games the player abandoned since the given time.
+func (s *service) CountAbandons(playerID string, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM game_participants WHERE player_id = ? AND abandoned = 1 AND left_at > ?`,
+		playerID, sqliteTime(since)).Scan(&count)
+	return count, err
+}
+
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", dburl)
+	slog.Info("Disconnected from database", "url", s.dburl)
 	return s.db.Close()
 }
 
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Friendship statuses as seen from the player listing their friends
+const (
+	FriendAccepted = "friends"
+	FriendOutgoing = "outgoing"
+	FriendIncoming = "incoming"
+	FriendBlocked  = "blocked"
+)
+
+// Statuses stored in the friendships table, rows are directed from player_id to friend_id
+const (
+	friendshipPending  = "pending"
+	friendshipAccepted = "accepted"
+	friendshipBlocked  = "blocked"
+)
+
+var (
+	ErrFriendRequestNotFound = errors.New("friend request not found")
+	ErrPlayerBlocked         = errors.New("player is blocked")
+	ErrAlreadyFriends        = errors.New("already friends or request pending")
+)
+
+type Friend struct {
+	PlayerID string    `json:"playerId"`
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Since    time.Time `json:"since"`
+}
+
+func (s *service) SendFriendRequest(playerID, friendID string, now time.Time) error {
+	var status string
+	err := s.db.QueryRow(
+		`SELECT status FROM friendships WHERE (player_id = ? AND friend_id = ?) OR (player_id = ? AND friend_id = ?) ORDER BY status = 'blocked' DESC LIMIT 1`,
+		playerID, friendID, friendID, playerID).Scan(&status)
+	if err == nil {
+		if status == friendshipBlocked {
+			return ErrPlayerBlocked
+		}
+		return ErrAlreadyFriends
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO friendships (player_id, friend_id, status, created_at) VALUES (?, ?, ?, ?)`,
+		playerID, friendID, friendshipPending, sqliteTime(now))
+	return err
+}
+
+// AcceptFriendRequest accepts the request friendID sent to playerID.
+func (s *service) AcceptFriendRequest(playerID, friendID string, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE friendships SET status = ?, created_at = ? WHERE player_id = ? AND friend_id = ? AND status = ?`,
+		friendshipAccepted, sqliteTime(now), friendID, playerID, friendshipPending)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrFriendRequestNotFound
+	}
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO friendships (player_id, friend_id, status, created_at) VALUES (?, ?, ?, ?)`,
+		playerID, friendID, friendshipAccepted, sqliteTime(now))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveFriend removes a friendship or pending request in either direction. Blocks are kept.
+func (s *service) RemoveFriend(playerID, friendID string) error {
+	_, err := s.db.Exec(
+		`DELETE FROM friendships WHERE status != ? AND ((player_id = ? AND friend_id = ?) OR (player_id = ? AND friend_id = ?))`,
+		friendshipBlocked, playerID, friendID, friendID, playerID)
+	return err
+}
+
+// BlockPlayer ends any friendship between the players and stops blockedID from sending requests.
+func (s *service) BlockPlayer(playerID, blockedID string, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`DELETE FROM friendships WHERE status != ? AND ((player_id = ? AND friend_id = ?) OR (player_id = ? AND friend_id = ?))`,
+		friendshipBlocked, playerID, blockedID, blockedID, playerID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO friendships (player_id, friend_id, status, created_at) VALUES (?, ?, ?, ?)`,
+		playerID, blockedID, friendshipBlocked, sqliteTime(now))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetFriends returns the player's friends, pending requests in both directions and blocked players.
+func (s *service) GetFriends(playerID string) ([]Friend, error) {
+	rows, err := s.db.Query(
+		`SELECT f.friend_id, COALESCE(p.name, ''), CASE f.status WHEN 'accepted' THEN ? WHEN 'pending' THEN ? ELSE ? END, f.created_at
+		FROM friendships f LEFT JOIN players p ON p.player_id = f.friend_id WHERE f.player_id = ?
+		UNION ALL
+		SELECT f.player_id, COALESCE(p.name, ''), ?, f.created_at
+		FROM friendships f LEFT JOIN players p ON p.player_id = f.player_id WHERE f.friend_id = ? AND f.status = 'pending'`,
+		FriendAccepted, FriendOutgoing, FriendBlocked, playerID, FriendIncoming, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	friends := []Friend{}
+	for rows.Next() {
+		var friend Friend
+		if err := rows.Scan(&friend.PlayerID, &friend.Name, &friend.Status, &friend.Since); err != nil {
+			return nil, err
+		}
+		friends = append(friends, friend)
+	}
+	return friends, rows.Err()
+}
+
+// GetFriendIDs returns the IDs of the player's accepted friends.
+func (s *service) GetFriendIDs(playerID string) ([]string, error) {
+	rows, err := s.db.Query(
+		`SELECT friend_id FROM friendships WHERE player_id = ? AND status = ?`,
+		playerID, friendshipAccepted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Rating every player starts a season with
+const DefaultRating = 1000
+
+// GlobalLeaderboard is the leaderboard rated across all modes
+const GlobalLeaderboard = "global"
+
+var (
+	ErrPlayerNotRanked = errors.New("player is not ranked")
+	ErrSeasonNotFound  = errors.New("season not found")
+)
+
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	PlayerID string `json:"playerId"`
+	Name     string `json:"name"`
+	Rating   int    `json:"rating"`
+	Games    int    `json:"games"`
+}
+
+type Season struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+// GetRatings returns the current ratings of the players on the leaderboard. Unrated players are left out.
+func (s *service) GetRatings(leaderboard string, playerIDs []string) (map[string]int, error) {
+	ratings := make(map[string]int)
+	for _, playerID := range playerIDs {
+		var rating int
+		err := s.db.QueryRow(
+			`SELECT rating FROM player_ratings WHERE leaderboard = ? AND player_id = ?`,
+			leaderboard, playerID).Scan(&rating)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ratings[playerID] = rating
+	}
+	return ratings, nil
+}
+
+// UpdateRatings adds the rating changes of a finished game to the leaderboard.
+func (s *service) UpdateRatings(leaderboard string, changes map[string]int, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for playerID, change := range changes {
+		_, err := tx.Exec(
+			`INSERT INTO player_ratings (leaderboard, player_id, rating, games, updated_at) VALUES (?, ?, ?, 1, ?)
+			ON CONFLICT (leaderboard, player_id) DO UPDATE SET
+				rating = rating + ?,
+				games = games + 1,
+				updated_at = excluded.updated_at`,
+			leaderboard, playerID, DefaultRating+change, sqliteTime(now), change)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetLeaderboard returns a page of the leaderboard, best rated first, and the number of ranked players.
+func (s *service) GetLeaderboard(leaderboard string, offset, limit int) ([]LeaderboardEntry, int, error) {
+	var total int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM player_ratings WHERE leaderboard = ?`, leaderboard).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query(
+		`SELECT r.player_id, COALESCE(p.name, (SELECT gp.name FROM game_participants gp WHERE gp.player_id = r.player_id ORDER BY gp.joined_at DESC LIMIT 1), ''),
+		r.rating, r.games
+		FROM player_ratings r LEFT JOIN players p ON p.player_id = r.player_id
+		WHERE r.leaderboard = ? ORDER BY r.rating DESC, r.player_id LIMIT ? OFFSET ?`,
+		leaderboard, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := scanLeaderboard(rows, offset)
+	return entries, total, err
+}
+
+// GetLeaderboardPosition returns the zero based position of the player on the leaderboard,
+// in the same order GetLeaderboard pages through.
+func (s *service) GetLeaderboardPosition(leaderboard, playerID string) (int, error) {
+	var rating int
+	err := s.db.QueryRow(
+		`SELECT rating FROM player_ratings WHERE leaderboard = ? AND player_id = ?`,
+		leaderboard, playerID).Scan(&rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrPlayerNotRanked
+	}
+	if err != nil {
+		return 0, err
+	}
+	var position int
+	err = s.db.QueryRow(
+		`SELECT COUNT(*) FROM player_ratings WHERE leaderboard = ? AND (rating > ? OR (rating = ? AND player_id < ?))`,
+		leaderboard, rating, rating, playerID).Scan(&position)
+	return position, err
+}
+
+// StartFirstSeason starts the first season at now unless there already is one.
+func (s *service) StartFirstSeason(now time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO seasons (name, started_at) SELECT 'Season 1', ? WHERE NOT EXISTS (SELECT 1 FROM seasons)`,
+		sqliteTime(now))
+	return err
+}
+
+// CurrentSeason returns the season in progress.
+func (s *service) CurrentSeason() (*Season, error) {
+	row := s.db.QueryRow(`SELECT id, name, started_at, ended_at FROM seasons WHERE ended_at IS NULL ORDER BY id DESC LIMIT 1`)
+	return scanSeason(row)
+}
+
+// EndSeason archives the final standings of every leaderboard, soft resets all ratings towards
+// DefaultRating by keeping resetFactor of the distance to it, and starts the next season.
+// Without a name the next season is numbered. The seasons change over at now.
+func (s *service) EndSeason(nextName string, resetFactor float64, now time.Time) (*Season, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var seasonID int64
+	err = tx.QueryRow(`SELECT id FROM seasons WHERE ended_at IS NULL ORDER BY id DESC LIMIT 1`).Scan(&seasonID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO season_standings (season_id, leaderboard, player_id, rank, rating, games)
+		SELECT ?, leaderboard, player_id, ROW_NUMBER() OVER (PARTITION BY leaderboard ORDER BY rating DESC, player_id), rating, games
+		FROM player_ratings`,
+		seasonID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		`UPDATE player_ratings SET rating = ? + CAST(ROUND((rating - ?) * ?) AS INTEGER), games = 0, updated_at = ?`,
+		DefaultRating, DefaultRating, math.Max(0, math.Min(1, resetFactor)), sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE seasons SET ended_at = ? WHERE id = ?`, sqliteTime(now), seasonID)
+	if err != nil {
+		return nil, err
+	}
+	if nextName == "" {
+		nextName = fmt.Sprintf("Season %d", seasonID+1)
+	}
+	_, err = tx.Exec(`INSERT INTO seasons (name, started_at) VALUES (?, ?)`, nextName, sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.CurrentSeason()
+}
+
+// GetSeasons returns every season, newest first.
+func (s *service) GetSeasons() ([]Season, error) {
+	rows, err := s.db.Query(`SELECT id, name, started_at, ended_at FROM seasons ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seasons := []Season{}
+	for rows.Next() {
+		season, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, *season)
+	}
+	return seasons, rows.Err()
+}
+
+// GetSeasonStandings returns a page of the final standings of an ended season's leaderboard.
+func (s *service) GetSeasonStandings(seasonID int64, leaderboard string, offset, limit int) ([]LeaderboardEntry, int, error) {
+	var total int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM season_standings WHERE season_id = ? AND leaderboard = ?`,
+		seasonID, leaderboard).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query(
+		`SELECT st.player_id, COALESCE(p.name, (SELECT gp.name FROM game_participants gp WHERE gp.player_id = st.player_id ORDER BY gp.joined_at DESC LIMIT 1), ''),
+		st.rating, st.games
+		FROM season_standings st LEFT JOIN players p ON p.player_id = st.player_id
+		WHERE st.season_id = ? AND st.leaderboard = ? ORDER BY st.rank LIMIT ? OFFSET ?`,
+		seasonID, leaderboard, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := scanLeaderboard(rows, offset)
+	return entries, total, err
+}
+
+// GetSeason returns the season with the ID.
+func (s *service) GetSeason(seasonID int64) (*Season, error) {
+	row := s.db.QueryRow(`SELECT id, name, started_at, ended_at FROM seasons WHERE id = ?`, seasonID)
+	season, err := scanSeason(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSeasonNotFound
+	}
+	return season, err
+}
+
+// scanLeaderboard reads leaderboard rows ranked from offset + 1 and closes them.
+func scanLeaderboard(rows *sql.Rows, offset int) ([]LeaderboardEntry, error) {
+	defer rows.Close()
+	entries := []LeaderboardEntry{}
+	for rows.Next() {
+		entry := LeaderboardEntry{Rank: offset + len(entries) + 1}
+		if err := rows.Scan(&entry.PlayerID, &entry.Name, &entry.Rating, &entry.Games); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanSeason(row interface{ Scan(...interface{}) error }) (*Season, error) {
+	var season Season
+	var endedAt sql.NullTime
+	if err := row.Scan(&season.ID, &season.Name, &season.StartedAt, &endedAt); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		season.EndedAt = &endedAt.Time
+	}
+	return &season, nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Report statuses
+const (
+	ReportOpen     = "open"
+	ReportReviewed = "reviewed"
+)
+
+var ErrReportNotFound = errors.New("report not found")
+
+type Report struct {
+	ID         int64  `json:"id"`
+	ReporterID string `json:"reporterId"`
+	ReportedID string `json:"reportedId"`
+	GameID     string `json:"gameId,omitempty"`
+	Reason     string `json:"reason"`
+	// JSON encoded chat messages the reporter saw before reporting
+	ChatContext string     `json:"chatContext"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ReviewedBy  string     `json:"reviewedBy,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewedAt,omitempty"`
+	Resolution  string     `json:"resolution,omitempty"`
+}
+
+func (s *service) StorePlayerMute(playerID, mutedPlayerID string, now time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT OR IGNORE INTO player_mutes (player_id, muted_player_id, created_at) VALUES (?, ?, ?)`,
+		playerID, mutedPlayerID, sqliteTime(now))
+	return err
+}
+
+func (s *service) DeletePlayerMute(playerID, mutedPlayerID string) error {
+	_, err := s.db.Exec(
+		`DELETE FROM player_mutes WHERE player_id = ? AND muted_player_id = ?`,
+		playerID, mutedPlayerID)
+	return err
+}
+
+// GetPlayerMutes returns the IDs of the players the player muted.
+func (s *service) GetPlayerMutes(playerID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT muted_player_id FROM player_mutes WHERE player_id = ?`, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	muted := []string{}
+	for rows.Next() {
+		var mutedPlayerID string
+		if err := rows.Scan(&mutedPlayerID); err != nil {
+			return nil, err
+		}
+		muted = append(muted, mutedPlayerID)
+	}
+	return muted, rows.Err()
+}
+
+func (s *service) StoreReport(report Report) (int64, error) {
+	result, err := s.db.Exec(
+		`INSERT INTO player_reports (reporter_id, reported_id, game_id, reason, chat_context, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		report.ReporterID, report.ReportedID, report.GameID, report.Reason, report.ChatContext, ReportOpen, sqliteTime(report.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetReports returns the reports with the status, oldest first so they are reviewed in order.
+func (s *service) GetReports(status string) ([]Report, error) {
+	rows, err := s.db.Query(
+		`SELECT id, reporter_id, reported_id, game_id, reason, chat_context, status, created_at, reviewed_by, reviewed_at, resolution
+		FROM player_reports WHERE status = ? ORDER BY created_at`,
+		status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var report Report
+		var reviewedBy, resolution sql.NullString
+		var reviewedAt sql.NullTime
+		err := rows.Scan(&report.ID, &report.ReporterID, &report.ReportedID, &report.GameID, &report.Reason,
+			&report.ChatContext, &report.Status, &report.CreatedAt, &reviewedBy, &reviewedAt, &resolution)
+		if err != nil {
+			return nil, err
+		}
+		report.ReviewedBy = reviewedBy.String
+		report.Resolution = resolution.String
+		if reviewedAt.Valid {
+			report.ReviewedAt = &reviewedAt.Time
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (s *service) ReviewReport(reportID int64, reviewedBy, resolution string, now time.Time) error {
+	result, err := s.db.Exec(
+		`UPDATE player_reports SET status = ?, reviewed_by = ?, reviewed_at = ?, resolution = ? WHERE id = ?`,
+		ReportReviewed, reviewedBy, sqliteTime(now), resolution, reportID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrReplayNotFound = errors.New("replay not found")
+
+// StoreReplay keeps the compressed replay of a finished game.
+func (s *service) StoreReplay(gameID string, data []byte, now time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO replays (game_id, data, created_at) VALUES (?, ?, ?)`,
+		gameID, data, sqliteTime(now))
+	return err
+}
+
+func (s *service) GetReplay(gameID string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM replays WHERE game_id = ?`, gameID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReplayNotFound
+	}
+	return data, err
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Reasons a game ended
+const (
+	EndCompleted   = "completed"
+	EndForfeit     = "forfeit"
+	EndTimeout     = "timeout"
+	EndAdminClosed = "admin_closed"
+	// Every human left the game
+	EndAbandoned = "abandoned"
+)
+
+var ErrGameResultNotFound = errors.New("game result not found")
+
+// GameResult is how a game ended, sent to its players and kept in game_results.
+type GameResult struct {
+	GameID    string `json:"gameId"`
+	Mode      string `json:"mode"`
+	EndReason string `json:"endReason"`
+	// WinnerTeam is set in team modes and WinnerID otherwise, neither is set on a draw
+	WinnerTeam *int             `json:"winnerTeam,omitempty"`
+	WinnerID   string           `json:"winnerId,omitempty"`
+	Players    []PlayerStanding `json:"players"`
+	EndedAt    time.Time        `json:"endedAt"`
+}
+
+type PlayerStanding struct {
+	PlayerID  string `json:"playerId"`
+	Name      string `json:"name"`
+	IsBot     bool   `json:"isBot"`
+	Team      int    `json:"team"`
+	Score     int    `json:"score"`
+	Kills     int    `json:"kills"`
+	Deaths    int    `json:"deaths"`
+	Placement int    `json:"placement"`
+	// Abandoned players left before the end and are placed last
+	Abandoned bool `json:"abandoned,omitempty"`
+}
+
+func (s *service) StoreGameResult(result GameResult) error {
+	players, err := json.Marshal(result.Players)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT OR REPLACE INTO game_results (game_id, mode, end_reason, winner_team, winner_id, players, ended_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		result.GameID, result.Mode, result.EndReason, result.WinnerTeam, result.WinnerID, string(players), result.EndedAt.UTC().Format(sqliteTimeLayout))
+	return err
+}
+
+func (s *service) GetGameResult(gameID string) (*GameResult, error) {
+	result := GameResult{GameID: gameID}
+	var winnerTeam sql.NullInt64
+	var players string
+	err := s.db.QueryRow(
+		`SELECT mode, end_reason, winner_team, winner_id, players, ended_at FROM game_results WHERE game_id = ?`,
+		gameID).Scan(&result.Mode, &result.EndReason, &winnerTeam, &result.WinnerID, &players, &result.EndedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGameResultNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if winnerTeam.Valid {
+		team := int(winnerTeam.Int64)
+		result.WinnerTeam = &team
+	}
+	if err := json.Unmarshal([]byte(players), &result.Players); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
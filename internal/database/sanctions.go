@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Kinds of sanctions that can be applied to a player
+const (
+	SanctionBan                 = "ban"
+	SanctionSuspension          = "suspension"
+	SanctionChatMute            = "chat_mute"
+	SanctionMatchmakingCooldown = "matchmaking_cooldown"
+)
+
+var ErrSanctionNotFound = errors.New("sanction not found")
+
+// Layout sqlite's datetime('now') uses, timestamps are stored in UTC with it so they compare as text
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// sqliteTime formats t for storing and comparing against stored timestamps. Timestamps are passed
+// in from the server's clock rather than taken from datetime('now').
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+type Sanction struct {
+	ID        int64      `json:"id"`
+	PlayerID  string     `json:"playerId"`
+	Type      string     `json:"type"`
+	Reason    string     `json:"reason"`
+	IssuedBy  string     `json:"issuedBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	LiftedAt  *time.Time `json:"liftedAt,omitempty"`
+}
+
+// StoreSanction stores a sanction issued at its CreatedAt.
+func (s *service) StoreSanction(sanction Sanction) (int64, error) {
+	var expiresAt interface{}
+	if sanction.ExpiresAt != nil {
+		expiresAt = sqliteTime(*sanction.ExpiresAt)
+	}
+	result, err := s.db.Exec(
+		`INSERT INTO sanctions (player_id, type, reason, issued_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		sanction.PlayerID, sanction.Type, sanction.Reason, sanction.IssuedBy, sqliteTime(sanction.CreatedAt), expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *service) LiftSanction(sanctionID int64, now time.Time) error {
+	result, err := s.db.Exec(
+		`UPDATE sanctions SET lifted_at = ? WHERE id = ? AND lifted_at IS NULL`,
+		sqliteTime(now), sanctionID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSanctionNotFound
+	}
+	return nil
+}
+
+// GetActiveSanctions returns the player's sanctions that have neither expired by now nor been lifted.
+func (s *service) GetActiveSanctions(playerID string, now time.Time) ([]Sanction, error) {
+	return s.querySanctions(
+		`SELECT id, player_id, type, reason, issued_by, created_at, expires_at, lifted_at FROM sanctions
+		WHERE player_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY created_at DESC`,
+		playerID, sqliteTime(now))
+}
+
+// GetSanctions returns all sanctions ever applied to the player, newest first.
+func (s *service) GetSanctions(playerID string) ([]Sanction, error) {
+	return s.querySanctions(
+		`SELECT id, player_id, type, reason, issued_by, created_at, expires_at, lifted_at FROM sanctions
+		WHERE player_id = ? ORDER BY created_at DESC`,
+		playerID)
+}
+
+func (s *service) querySanctions(query string, args ...interface{}) ([]Sanction, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sanctions := []Sanction{}
+	for rows.Next() {
+		var sanction Sanction
+		var expiresAt, liftedAt sql.NullTime
+		err := rows.Scan(&sanction.ID, &sanction.PlayerID, &sanction.Type, &sanction.Reason, &sanction.IssuedBy,
+			&sanction.CreatedAt, &expiresAt, &liftedAt)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			sanction.ExpiresAt = &expiresAt.Time
+		}
+		if liftedAt.Valid {
+			sanction.LiftedAt = &liftedAt.Time
+		}
+		sanctions = append(sanctions, sanction)
+	}
+	return sanctions, rows.Err()
+}
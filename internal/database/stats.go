@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrPlayerNotFound = errors.New("player not found")
+
+// PlayerResult is how a player who was still in the game when it closed finished it.
+type PlayerResult struct {
+	PlayerID  string
+	Placement int
+	Won       bool
+	// Lost is false for draws
+	Lost bool
+}
+
+type ModeStats struct {
+	Mode             string  `json:"mode,omitempty"`
+	GamesPlayed      int     `json:"gamesPlayed"`
+	Wins             int     `json:"wins"`
+	Losses           int     `json:"losses"`
+	Abandons         int     `json:"abandons"`
+	AveragePlacement float64 `json:"averagePlacement"`
+	PlayTimeSeconds  int64   `json:"playTimeSeconds"`
+	placedGames      int
+	placementTotal   int
+}
+
+type PlayerProfile struct {
+	PlayerID string      `json:"playerId"`
+	Name     string      `json:"name"`
+	JoinedAt *time.Time  `json:"joinedAt,omitempty"`
+	Stats    ModeStats   `json:"stats"`
+	Modes    []ModeStats `json:"modes"`
+}
+
+// Seconds between the participant joining and leaving the game, or the end of the game given as
+// its parameter if they stayed to the end
+const participantPlaySeconds = `CAST((julianday(COALESCE(left_at, ?)) - julianday(joined_at)) * 86400 AS INTEGER)`
+
+// RecordGameStats adds a game that ended at endedAt to the lifetime stats of its human players:
+// the results of those who finished it and an abandon for every participant who left early.
+func (s *service) RecordGameStats(gameID, mode string, results []PlayerResult, endedAt time.Time) error {
+	ended := sqliteTime(endedAt)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, result := range results {
+		_, err := tx.Exec(
+			`INSERT INTO player_stats (player_id, mode, games_played, wins, losses, abandons, placed_games, placement_total, play_seconds, updated_at)
+			SELECT player_id, ?, 1, ?, ?, 0, 1, ?, `+participantPlaySeconds+`, ?
+			FROM game_participants WHERE game_id = ? AND player_id = ?
+			ON CONFLICT (player_id, mode) DO UPDATE SET
+				games_played = games_played + 1,
+				wins = wins + excluded.wins,
+				losses = losses + excluded.losses,
+				placed_games = placed_games + 1,
+				placement_total = placement_total + excluded.placement_total,
+				play_seconds = play_seconds + excluded.play_seconds,
+				updated_at = excluded.updated_at`,
+			mode, result.Won, result.Lost, result.Placement, ended, ended, gameID, result.PlayerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO player_stats (player_id, mode, games_played, wins, losses, abandons, placed_games, placement_total, play_seconds, updated_at)
+		SELECT player_id, ?, 1, 0, 0, 1, 0, 0, `+participantPlaySeconds+`, ?
+		FROM game_participants WHERE game_id = ? AND abandoned = 1 AND is_bot = 0
+		ON CONFLICT (player_id, mode) DO UPDATE SET
+			games_played = games_played + 1,
+			abandons = abandons + 1,
+			play_seconds = play_seconds + excluded.play_seconds,
+			updated_at = excluded.updated_at`,
+		mode, ended, ended, gameID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPlayerProfile returns the player's lifetime stats over all modes and per mode.
+func (s *service) GetPlayerProfile(playerID string) (*PlayerProfile, error) {
+	profile := &PlayerProfile{PlayerID: playerID, Modes: []ModeStats{}}
+	var joinedAt sql.NullTime
+	err := s.db.QueryRow(`SELECT name, joined_at FROM players WHERE player_id = ?`, playerID).Scan(&profile.Name, &joinedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if joinedAt.Valid {
+		profile.JoinedAt = &joinedAt.Time
+	}
+	found := err == nil
+
+	rows, err := s.db.Query(
+		`SELECT mode, games_played, wins, losses, abandons, placed_games, placement_total, play_seconds
+		FROM player_stats WHERE player_id = ? ORDER BY mode`,
+		playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stats ModeStats
+		if err := rows.Scan(&stats.Mode, &stats.GamesPlayed, &stats.Wins, &stats.Losses, &stats.Abandons,
+			&stats.placedGames, &stats.placementTotal, &stats.PlayTimeSeconds); err != nil {
+			return nil, err
+		}
+		stats.AveragePlacement = averagePlacement(stats.placementTotal, stats.placedGames)
+		profile.Modes = append(profile.Modes, stats)
+
+		profile.Stats.GamesPlayed += stats.GamesPlayed
+		profile.Stats.Wins += stats.Wins
+		profile.Stats.Losses += stats.Losses
+		profile.Stats.Abandons += stats.Abandons
+		profile.Stats.PlayTimeSeconds += stats.PlayTimeSeconds
+		profile.Stats.placedGames += stats.placedGames
+		profile.Stats.placementTotal += stats.placementTotal
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	profile.Stats.AveragePlacement = averagePlacement(profile.Stats.placementTotal, profile.Stats.placedGames)
+
+	if !found && len(profile.Modes) == 0 {
+		return nil, ErrPlayerNotFound
+	}
+	if profile.Name == "" {
+		// Players who never called /create-player are only known by the name they played under
+		s.db.QueryRow(
+			`SELECT name FROM game_participants WHERE player_id = ? ORDER BY joined_at DESC LIMIT 1`,
+			playerID).Scan(&profile.Name)
+	}
+	return profile, nil
+}
+
+func averagePlacement(total, games int) float64 {
+	if games == 0 {
+		return 0
+	}
+	return float64(total) / float64(games)
+}
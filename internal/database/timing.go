@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// QueryObserver is told how long each query took, along with the kind of statement it ran:
+// select, insert, update, delete or another SQL keyword in lower case.
+type QueryObserver func(statement string, d time.Duration)
+
+// timedDB times the queries run outside of transactions and reports them to its observer.
+type timedDB struct {
+	*sql.DB
+	observe QueryObserver
+}
+
+func (db *timedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer db.done(query, time.Now())
+	return db.DB.Exec(query, args...)
+}
+
+func (db *timedDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer db.done(query, time.Now())
+	return db.DB.Query(query, args...)
+}
+
+// QueryRow only times running the query, the row is read when it is scanned.
+func (db *timedDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer db.done(query, time.Now())
+	return db.DB.QueryRow(query, args...)
+}
+
+func (db *timedDB) done(query string, start time.Time) {
+	if db.observe != nil {
+		db.observe(statementKind(query), time.Since(start))
+	}
+}
+
+// statementKind returns the first keyword of the query, which keeps the number of metric labels small.
+func statementKind(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(fields[0])
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// How often a bot sends an input, matches the client simulator
+const botInputInterval = time.Second
+
+// Ticks between two inputs of a bot
+const botInputTicks = int64(botInputInterval / tickInterval)
+
+var errBotClosed = errors.New("bot connection closed")
+
+// Bot decides the inputs of a server-side player. Bots are driven by their game on tick
+// boundaries and draw from the game's random source, so matches with bots can be reproduced from
+// their seed.
+type Bot interface {
+	// NextInput returns the next input of the bot at the tick, given the latest game state.
+	NextInput(state map[string]interface{}, rng *rand.Rand, tick int64) PlayerInput
+}
+
+// wanderBot moves in a random direction every input.
+type wanderBot struct{}
+
+func (wanderBot) NextInput(state map[string]interface{}, rng *rand.Rand, tick int64) PlayerInput {
+	return PlayerInput{
+		Action:    "move",
+		Direction: directions[rng.Intn(len(directions))],
+	}
+}
+
+// botConn stands in for the websocket connection of a bot. The bot's inputs come from its game,
+// which also notices when the bot is closed, so nothing reads from it and writes are dropped.
+type botConn struct {
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newBotConn() *botConn {
+	return &botConn{closed: make(chan struct{})}
+}
+
+func (c *botConn) ReadMessage() (int, []byte, error) {
+	<-c.closed
+	return 0, nil, errBotClosed
+}
+
+func (c *botConn) WriteJSON(v interface{}) error {
+	select {
+	case <-c.closed:
+		return errBotClosed
+	default:
+	}
+	return nil
+}
+
+func (c *botConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return c.Close()
+	}
+	return nil
+}
+
+// isClosed reports whether the bot was closed, for instance when it was kicked.
+func (c *botConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *botConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// newBot creates a bot player for the mode. Its game drives it, so it needs no goroutine.
+func (s *Server) newBot(mode *GameMode) *Player {
+	id := "bot-" + uuid.New().String()
+	bot := &Player{
+		Conn:       newBotConn(),
+		bot:        wanderBot{},
+		ID:         id,
+		Name:       fmt.Sprintf("Bot %s", id[4:12]),
+		Mode:       mode.Name,
+		IsBot:      true,
+		LastActive: s.clock.Now(),
+		QueuedAt:   s.clock.Now(),
+		logger:     slog.With("player_id", id, "mode", mode.Name),
+	}
+	return bot
+}
+
+// queueBotInputs queues the next input of every connected bot in the game every botInputTicks,
+// before the tick's inputs are applied. Bots that were closed are disconnected like players whose
+// socket dropped. Must be called on the game's goroutine.
+func (s *Server) queueBotInputs(game *Game) {
+	if game.Tick%botInputTicks != 0 {
+		return
+	}
+	for _, player := range game.Players {
+		if player.bot == nil || player.Disconnected {
+			continue
+		}
+		if conn, ok := player.Conn.(*botConn); ok && conn.isClosed() {
+			player.Disconnected = true
+			player.DisconnectedAt = s.clock.Now()
+			continue
+		}
+		data, err := json.Marshal(player.bot.NextInput(game.GameState, game.Rand, game.Tick))
+		if err != nil {
+			game.playerLogger(player).Error("Error encoding bot input", "error", err)
+			continue
+		}
+		player.LastActive = s.clock.Now()
+		game.queueInput(player, data)
+	}
+}
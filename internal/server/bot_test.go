@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+// botPositions plays a game of bots for the number of ticks and returns where each bot ended up.
+func botPositions(t *testing.T, seed int64, ticks int64) []string {
+	t.Helper()
+	s := newTestServer(t, NewFakeClock(testEpoch))
+	game := &Game{ID: "game", Mode: defaultMode, StartedAt: testEpoch, Rand: newGameRand(seed), logger: slog.Default()}
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("bot-%d", i)
+		bot := &Player{ID: id, Name: id, Conn: newBotConn(), bot: wanderBot{}, IsBot: true, logger: slog.Default()}
+		game.spawn(bot)
+		game.Players = append(game.Players, bot)
+	}
+	for game.Tick < ticks {
+		s.stepGame(game)
+	}
+	positions := []string{}
+	for _, bot := range game.Players {
+		positions = append(positions, fmt.Sprintf("%.3f,%.3f", bot.X, bot.Y))
+	}
+	return positions
+}
+
+func TestBotsFollowGameSeed(t *testing.T) {
+	ticks := 20 * botInputTicks
+	if fmt.Sprint(botPositions(t, 42, 0)) == fmt.Sprint(botPositions(t, 42, ticks)) {
+		t.Fatal("bots never moved")
+	}
+	first := botPositions(t, 42, ticks)
+	second := botPositions(t, 42, ticks)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Fatalf("bots of games with the same seed diverged: %v and %v", first, second)
+	}
+}
+
+func TestHistoryLeavesBotsOut(t *testing.T) {
+	s := newTestServer(t, NewFakeClock(testEpoch))
+	human := newTestPlayer(s, "human")
+	bot := s.newBot(gameModes[defaultMode])
+	if got := historyPlayers([]*Player{human, bot}); got != "human" {
+		t.Fatalf("history lists %q, want only the human", got)
+	}
+}
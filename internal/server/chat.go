@@ -0,0 +1,251 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"game-server/internal/database"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Chat scopes
+const (
+	chatScopeAll    = "all"
+	chatScopeTeam   = "team"
+	chatScopeParty  = "party"
+	chatScopeDirect = "direct"
+)
+
+var (
+	chatMaxLength = envInt("CHAT_MAX_LENGTH", 256)
+	// Most chat messages a player can send within chatRateWindow
+	chatRateLimit  = envInt("CHAT_RATE_LIMIT", 5)
+	chatRateWindow = envDuration("CHAT_RATE_WINDOW", 10*time.Second)
+	// Chat messages a game keeps for players that reconnect
+	chatHistorySize = envInt("CHAT_HISTORY_SIZE", 50)
+)
+
+// Message types on the player socket. Messages without a type are game inputs.
+const (
+	messageTypeChat      = "chat"
+	messageTypeChatError = "chat_error"
+)
+
+// ChatMessage is both the inbound chat request and the message fanned out to recipients.
+type ChatMessage struct {
+	Type     string    `json:"type"`
+	Scope    string    `json:"scope"`
+	To       string    `json:"to,omitempty"`
+	Text     string    `json:"text"`
+	From     string    `json:"from,omitempty"`
+	FromName string    `json:"fromName,omitempty"`
+	Team     int       `json:"team,omitempty"`
+	PartyID  string    `json:"partyId,omitempty"`
+	SentAt   time.Time `json:"sentAt"`
+}
+
+// visibleTo reports whether the player may see the message, used when replaying chat history.
+func (m *ChatMessage) visibleTo(player *Player) bool {
+	switch m.Scope {
+	case chatScopeTeam:
+		return player.Team == m.Team
+	case chatScopeParty:
+		return player.PartyID != "" && player.PartyID == m.PartyID
+	case chatScopeDirect:
+		return player.ID == m.From || player.ID == m.To
+	}
+	return true
+}
+
+// handleChat validates a chat message from the player and fans it out to the recipients of its scope.
+func (s *Server) handleChat(player *Player, data []byte) {
+	var msg ChatMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		sendChatError(player, "Malformed chat message")
+		return
+	}
+	msg.Text = strings.TrimSpace(msg.Text)
+	if msg.Text == "" {
+		sendChatError(player, "Empty chat message")
+		return
+	}
+	if utf8.RuneCountInString(msg.Text) > chatMaxLength {
+		sendChatError(player, fmt.Sprintf("Chat messages are limited to %d characters", chatMaxLength))
+		return
+	}
+	if sanction := s.activeSanction(player.ID, database.SanctionChatMute); sanction != nil {
+		sendChatError(player, sanctionCloseReason(*sanction))
+		return
+	}
+	if reason := moderateChat(player, &msg); reason != "" {
+		sendChatError(player, reason)
+		return
+	}
+
+	s.mu.Lock()
+	now := s.clock.Now()
+	recent := []time.Time{}
+	for _, t := range player.chatTimes {
+		if now.Sub(t) < chatRateWindow {
+			recent = append(recent, t)
+		}
+	}
+	player.chatTimes = recent
+	limited := len(recent) >= chatRateLimit
+	if !limited {
+		player.chatTimes = append(recent, now)
+	}
+	msg.PartyID = player.PartyID
+	game := s.activeGames[player.GameID]
+	s.mu.Unlock()
+	if limited {
+		sendChatError(player, "You are sending messages too fast")
+		return
+	}
+
+	msg.Type = messageTypeChat
+	msg.From = player.ID
+	msg.FromName = player.Name
+	msg.SentAt = now
+
+	recipients, problem := s.chatRecipients(game, player, &msg)
+	if problem != "" {
+		sendChatError(player, problem)
+		return
+	}
+
+	s.mu.Lock()
+	delivered := []*Player{}
+	for _, recipient := range recipients {
+		if recipient.mutedPlayers[player.ID] {
+			continue
+		}
+		recipient.addRecentChat(&msg)
+		delivered = append(delivered, recipient)
+	}
+	s.mu.Unlock()
+	for _, recipient := range delivered {
+		if err := recipient.Conn.WriteJSON(msg); err != nil {
+			game.playerLogger(recipient).Warn("Error sending chat", "error", err)
+		}
+	}
+}
+
+// chatRecipients returns the players that receive the message, including the sender, or why the
+// message can't be delivered. Messages other than party chat are kept in the chat history of the
+// sender's game.
+func (s *Server) chatRecipients(game *Game, player *Player, msg *ChatMessage) ([]*Player, string) {
+	switch msg.Scope {
+	case chatScopeAll, chatScopeTeam:
+		recipients := []*Player{}
+		// Teams and the players in the game belong to the game's goroutine
+		inGame := game != nil && game.call(func() {
+			msg.Team = player.Team
+			for _, p := range game.Players {
+				if msg.Scope == chatScopeAll || p.Team == player.Team {
+					recipients = append(recipients, p)
+				}
+			}
+			game.addChat(msg)
+		})
+		if !inGame {
+			return nil, "Not in a game"
+		}
+		return recipients, ""
+	case chatScopeParty:
+		if msg.PartyID == "" {
+			return nil, "Not in a party"
+		}
+		recipients := []*Player{}
+		s.mu.Lock()
+		s.mutex.Lock()
+		for _, p := range s.clients {
+			if p.PartyID == msg.PartyID {
+				recipients = append(recipients, p)
+			}
+		}
+		// Members waiting in the lobby
+		for _, client := range s.lobbyClients {
+			if client.chat.PartyID == msg.PartyID {
+				recipients = append(recipients, client.chat)
+			}
+		}
+		s.mutex.Unlock()
+		s.mu.Unlock()
+		return recipients, ""
+	case chatScopeDirect:
+		if msg.To == "" {
+			return nil, "Missing recipient"
+		}
+		sessions := s.chatSessions(msg.To)
+		if len(sessions) == 0 {
+			return nil, "Player is not online"
+		}
+		if game != nil {
+			game.send(func() { game.addChat(msg) })
+		}
+		recipients := []*Player{player}
+		for _, session := range sessions {
+			if session != player {
+				recipients = append(recipients, session)
+			}
+		}
+		return recipients, ""
+	}
+	return nil, fmt.Sprintf("Invalid chat scope %q", msg.Scope)
+}
+
+// chatSessions returns the sessions chat reaches the player on: their match socket and their lobby
+// connection, whichever they have open.
+func (s *Server) chatSessions(playerId string) []*Player {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sessions := []*Player{}
+	if player, ok := s.clients[playerId]; ok {
+		sessions = append(sessions, player)
+	}
+	if client, ok := s.lobbyClients[playerId]; ok {
+		sessions = append(sessions, client.chat)
+	}
+	return sessions
+}
+
+// addChat keeps the message in the game's chat history. Must be called on the game's goroutine.
+func (g *Game) addChat(msg *ChatMessage) {
+	g.ChatHistory = append(g.ChatHistory, msg)
+	if len(g.ChatHistory) > chatHistorySize {
+		g.ChatHistory = g.ChatHistory[len(g.ChatHistory)-chatHistorySize:]
+	}
+}
+
+// addRecentChat keeps a message delivered to the player, used as context when they report someone.
+// Must be called with mu held.
+func (p *Player) addRecentChat(msg *ChatMessage) {
+	p.recentChat = append(p.recentChat, msg)
+	if len(p.recentChat) > chatHistorySize {
+		p.recentChat = p.recentChat[len(p.recentChat)-chatHistorySize:]
+	}
+}
+
+// chatHistoryFor returns the game's recent chat messages the player may see. Must be called on the
+// game's goroutine with mu held.
+func (g *Game) chatHistoryFor(player *Player) []*ChatMessage {
+	history := []*ChatMessage{}
+	for _, msg := range g.ChatHistory {
+		if msg.visibleTo(player) && !player.mutedPlayers[msg.From] {
+			history = append(history, msg)
+		}
+	}
+	return history
+}
+
+func sendChatError(player *Player, message string) {
+	err := player.Conn.WriteJSON(map[string]string{
+		"type":    messageTypeChatError,
+		"message": message,
+	})
+	if err != nil {
+		player.logger.Warn("Error sending chat error", "error", err)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// recordingConn keeps the messages written to it.
+type recordingConn struct {
+	*botConn
+	mu       sync.Mutex
+	messages []interface{}
+}
+
+func newRecordingConn() *recordingConn {
+	return &recordingConn{botConn: newBotConn()}
+}
+
+func (c *recordingConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, v)
+	return nil
+}
+
+func (c *recordingConn) chats() []ChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chats := []ChatMessage{}
+	for _, message := range c.messages {
+		if msg, ok := message.(ChatMessage); ok {
+			chats = append(chats, msg)
+		}
+	}
+	return chats
+}
+
+// connectLobby registers a lobby connection for the player, as LobbyConnect does.
+func connectLobby(s *Server, id, partyId string) *recordingConn {
+	conn := newRecordingConn()
+	client := &LobbyClient{ID: id, Name: id, Conn: conn, logger: slog.Default()}
+	client.chat = &Player{ID: id, Name: id, Conn: conn, PartyID: partyId, mutedPlayers: map[string]bool{}, logger: slog.Default()}
+	s.mutex.Lock()
+	s.lobbyClients[id] = client
+	s.mutex.Unlock()
+	return conn
+}
+
+func TestChatReachesPlayersInTheLobby(t *testing.T) {
+	s := newTestServer(t, NewFakeClock(testEpoch))
+	friend := connectLobby(s, "friend", "party")
+	member := connectLobby(s, "member", "party")
+	sender := newTestPlayer(s, "sender")
+	sender.PartyID = "party"
+
+	s.handleChat(sender, []byte(`{"type":"chat","scope":"direct","to":"friend","text":"hi"}`))
+	if got := len(friend.chats()); got != 1 {
+		t.Fatalf("friend in the lobby got %d direct messages, want 1", got)
+	}
+
+	s.mutex.Lock()
+	lobbySender := s.lobbyClients["member"].chat
+	s.mutex.Unlock()
+	s.handleChat(lobbySender, []byte(`{"type":"chat","scope":"party","text":"ready?"}`))
+	if got := len(friend.chats()); got != 2 {
+		t.Fatalf("party member in the lobby got %d messages, want the party chat too", got-1)
+	}
+	if got := len(member.chats()); got != 1 {
+		t.Fatalf("lobby sender got %d party messages back, want 1", got)
+	}
+}
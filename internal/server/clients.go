@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// What happens when a player ID connects while it already has a session, configured with
+// DUPLICATE_SESSION_POLICY. "reject" refuses the new connection, "supersede" (default)
+// kicks the older socket.
+const (
+	rejectDuplicateSessions    = "reject"
+	supersedeDuplicateSessions = "supersede"
+)
+
+var duplicateSessionPolicy = loadDuplicateSessionPolicy()
+
+func loadDuplicateSessionPolicy() string {
+	policy := os.Getenv("DUPLICATE_SESSION_POLICY")
+	if policy == rejectDuplicateSessions {
+		return policy
+	}
+	return supersedeDuplicateSessions
+}
+
+// How long a write to a socket may block before the connection is given up on, so a stalled
+// client can't hold up its writer for longer
+var writeTimeout = envDuration("WRITE_TIMEOUT", 5*time.Second)
+
+// Messages queued for a socket before it is considered too slow and dropped, a few seconds of
+// state updates
+var sendQueueSize = max(1, envInt("SEND_QUEUE_SIZE", 256))
+
+var (
+	errConnClosed    = errors.New("connection closed")
+	errSendQueueFull = errors.New("send queue full")
+	errAlreadyOnline = errors.New("player already connected")
+)
+
+type outgoingMessage struct {
+	messageType int
+	data        []byte
+}
+
+// safeConn queues writes to a websocket connection for a writer goroutine, as the socket supports
+// only one concurrent writer, and counts the messages and bytes it carries. Writes never block:
+// a connection whose queue is full is closed, so games never wait on the network.
+type safeConn struct {
+	*websocket.Conn
+	metrics *Metrics
+	mu      sync.Mutex
+	send    chan outgoingMessage
+	closed  bool
+}
+
+// newConn wraps an upgraded socket and starts its writer.
+func (s *Server) newConn(ws *websocket.Conn) *safeConn {
+	c := &safeConn{Conn: ws, metrics: s.metrics, send: make(chan outgoingMessage, sendQueueSize)}
+	go c.writeMessages()
+	return c
+}
+
+// writeMessages writes the queued messages until the connection is closed and its queue drained,
+// then closes the socket.
+func (c *safeConn) writeMessages() {
+	for message := range c.send {
+		// A network deadline, so it follows the wall clock rather than the server's clock
+		c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		err := c.Conn.WriteMessage(message.messageType, message.data)
+		c.metrics.sent(len(message.data), err)
+		if err != nil {
+			c.Close()
+			break
+		}
+	}
+	for range c.send {
+	}
+	c.Conn.Close()
+}
+
+func (c *safeConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *safeConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errConnClosed
+	}
+	select {
+	case c.send <- outgoingMessage{messageType: messageType, data: data}:
+		return nil
+	default:
+		c.metrics.sent(len(data), errSendQueueFull)
+		c.closeLocked()
+		return errSendQueueFull
+	}
+}
+
+// Close closes the socket once the messages queued before are written.
+func (c *safeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked()
+	return nil
+}
+
+func (c *safeConn) closeLocked() {
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+func (c *safeConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err == nil {
+		c.metrics.received(len(data))
+	}
+	return messageType, data, err
+}
+
+// connectedClient returns the player's current session, if any.
+func (s *Server) connectedClient(playerId string) *Player {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.clients[playerId]
+}
+
+// registerClient makes the player the session for its ID and returns the session it replaced.
+// Under the reject policy it returns errAlreadyOnline instead when the ID already has a session,
+// checked under the same lock as the insert so concurrent connects can't both get through.
+func (s *Server) registerClient(player *Player) (*Player, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous := s.clients[player.ID]
+	if previous != nil && duplicateSessionPolicy == rejectDuplicateSessions {
+		return nil, errAlreadyOnline
+	}
+	s.clients[player.ID] = player
+	return previous, nil
+}
+
+// unregisterClient removes the player's session unless it has already been superseded.
+func (s *Server) unregisterClient(player *Player) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.clients[player.ID] == player {
+		delete(s.clients, player.ID)
+	}
+}
+
+// droppedSession returns the player's session that dropped out of a running game, or nil.
+func (s *Server) droppedSession(playerId string) *Player {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.droppedSessions[playerId]
+}
+
+// forgetDroppedSessions drops the players from the sessions that can be taken back, once their
+// slot is released or their game is over. Must be called with mu held.
+func (s *Server) forgetDroppedSessions(players []*Player) {
+	for _, player := range players {
+		if s.droppedSessions[player.ID] == player {
+			delete(s.droppedSessions, player.ID)
+		}
+	}
+}
+
+// supersedeSession hands the previous session's game slot, if it has one, to the new session
+// and kicks the previous socket if it is still open. It reports whether the new session took
+// over a game slot.
+func (s *Server) supersedeSession(previous, player *Player) bool {
+	player.logger.Info("Player connected again, replacing previous session")
+
+	tookOver := false
+	if game := s.gameOf(previous); game != nil {
+		game.call(func() { tookOver = s.takeOverSlot(game, previous, player) })
+	}
+
+	previous.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Connected from another session"))
+	previous.Conn.Close()
+	return tookOver
+}
+
+// takeOverSlot replaces previous with player in the game and sends player a full snapshot.
+// Must be called on the game's goroutine.
+func (s *Server) takeOverSlot(game *Game, previous, player *Player) bool {
+	for i, p := range game.Players {
+		if p != previous {
+			continue
+		}
+		s.mu.Lock()
+		chat := game.chatHistoryFor(previous)
+		s.mu.Unlock()
+		err := player.Conn.WriteJSON(map[string]interface{}{
+			"gameId":   game.ID,
+			"region":   game.Region,
+			"team":     previous.Team,
+			"message":  "Rejoined game in progress",
+			"players":  playerNames(game.Players),
+			"snapshot": game.GameState,
+			"chat":     chat,
+		})
+		if err != nil {
+			game.playerLogger(player).Warn("Error sending snapshot", "error", err)
+			return false
+		}
+		s.mu.Lock()
+		player.GameID = game.ID
+		// The previous session no longer plays, its reader must not report it as leaving the game
+		previous.GameID = ""
+		s.forgetDroppedSessions([]*Player{previous})
+		s.mu.Unlock()
+		player.LastActive = s.clock.Now()
+		player.X, player.Y = previous.X, previous.Y
+		player.LastMoveAt = previous.LastMoveAt
+		player.actionTimes, player.lastActionAt = previous.actionTimes, previous.lastActionAt
+		player.Team = previous.Team
+		player.Score = previous.Score
+		player.Kills, player.Deaths = previous.Kills, previous.Deaths
+		// Reconnecting doesn't clear the violations of the game
+		player.violationScore, player.violationAt = previous.violationScore, previous.violationAt
+		game.Players[i] = player
+		game.Replay.recordTakeover(game.Tick, previous, player)
+		// Inputs the previous session sent before it dropped still belong to the slot
+		for j := range game.pendingInputs {
+			if game.pendingInputs[j].player == previous {
+				game.pendingInputs[j].player = player
+			}
+		}
+		game.playerLogger(player).Info("Player took over their slot")
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTakeOverSlotKeepsQueuedInputs(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+	previous := newTestPlayer(s, "player")
+	opponent := newTestPlayer(s, "opponent")
+	opponent.Team = 1
+	game := &Game{
+		ID:      "game",
+		Mode:    defaultMode,
+		Players: []*Player{previous, opponent},
+		logger:  slog.Default(),
+	}
+	game.queueInput(previous, []byte(`{"action":"attack","target":"opponent"}`))
+
+	player := newTestPlayer(s, "player")
+	if !s.takeOverSlot(game, previous, player) {
+		t.Fatal("takeOverSlot failed")
+	}
+	s.stepGame(game)
+	if player.Score != 1 {
+		t.Fatalf("new session scored %d, want the queued attack to count", player.Score)
+	}
+}
+
+func TestRejectPolicyAdmitsOneOfConcurrentSessions(t *testing.T) {
+	policy := duplicateSessionPolicy
+	duplicateSessionPolicy = rejectDuplicateSessions
+	t.Cleanup(func() { duplicateSessionPolicy = policy })
+	s := newTestServer(t, NewFakeClock(testEpoch))
+
+	const sessions = 8
+	var wg sync.WaitGroup
+	var admitted atomic.Int32
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if previous, err := s.registerClient(newTestPlayer(s, "player")); err == nil {
+				admitted.Add(1)
+				if previous != nil {
+					t.Errorf("admitted session replaced %p", previous)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := admitted.Load(); got != 1 {
+		t.Fatalf("admitted %d of %d concurrent sessions, want 1", got, sessions)
+	}
+}
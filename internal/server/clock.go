@@ -0,0 +1,152 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is where the server reads time and waits from. Matchmaking, the game loop, inactivity
+// checks and the other time dependent logic go through it instead of the time package, so tests
+// can run the server on a FakeClock and advance time without waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C every period until it is stopped, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
+
+// FakeClock is a Clock that only moves when Advance is called. Timers, sleeps and tickers fire
+// as Advance passes their deadlines, in deadline order.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	// Signalled whenever a waiter is added, for BlockUntil
+	added *sync.Cond
+}
+
+// fakeWaiter is a pending After, Sleep or ticker on a FakeClock.
+type fakeWaiter struct {
+	at time.Time
+	// Period of a ticker, 0 for one-shot waiters
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.added = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.addWaiter(d, 0)
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return &fakeTicker{clock: c, c: c.addWaiter(d, d)}
+}
+
+func (c *FakeClock) addWaiter(d, period time.Duration) chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, &fakeWaiter{at: c.now.Add(d), period: period, c: ch})
+	c.added.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d, firing every waiter whose deadline it passes. Like
+// time.Ticker, a ticker whose last tick hasn't been received yet drops the ticks in between.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+		if len(c.waiters) == 0 || c.waiters[0].at.After(end) {
+			break
+		}
+		waiter := c.waiters[0]
+		c.now = waiter.at
+		select {
+		case waiter.c <- c.now:
+		default:
+		}
+		if waiter.period > 0 {
+			waiter.at = waiter.at.Add(waiter.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+	c.now = end
+}
+
+// BlockUntil waits until at least n waiters are pending on the clock, so a test can be sure the
+// goroutines it is about to advance time for have started waiting.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.added.Wait()
+	}
+}
+
+func (c *FakeClock) removeWaiter(ch chan time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, waiter := range c.waiters {
+		if waiter.c == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	c     chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               { t.clock.removeWaiter(t.c) }
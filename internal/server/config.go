@@ -0,0 +1,66 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envInt reads an integer setting from the environment, falling back to def when unset or invalid.
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return n
+}
+
+// envDuration reads a duration setting such as "30s" from the environment, falling back to def
+// when unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return d
+}
+
+// envFloat reads a decimal setting from the environment, falling back to def when unset or invalid.
+func envFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return f
+}
+
+// envBool reads an on/off setting such as "true" or "0" from the environment, falling back to def
+// when unset or invalid.
+func envBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return b
+}
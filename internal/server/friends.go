@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"game-server/internal/database"
+	"net/http"
+)
+
+type friendRequest struct {
+	PlayerID string `json:"playerId"`
+	FriendID string `json:"friendId"`
+}
+
+// decodeFriendRequest reads the two players a friends endpoint acts on, writing the error response if invalid.
+func decodeFriendRequest(w http.ResponseWriter, r *http.Request) (friendRequest, bool) {
+	var req friendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	if req.PlayerID == "" || req.FriendID == "" {
+		http.Error(w, "Missing playerId or friendId", http.StatusBadRequest)
+		return req, false
+	}
+	if req.PlayerID == req.FriendID {
+		http.Error(w, "Players can't befriend themselves", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func (s *Server) SendFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFriendRequest(w, r)
+	if !ok {
+		return
+	}
+	err := s.db.SendFriendRequest(req.PlayerID, req.FriendID, s.clock.Now())
+	if errors.Is(err, database.ErrPlayerBlocked) || errors.Is(err, database.ErrAlreadyFriends) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.notify(req.FriendID, map[string]string{
+		"type": lobbyFriendRequest,
+		"from": req.PlayerID,
+	})
+	response := map[string]string{
+		"message":  "Friend request sent",
+		"friendId": req.FriendID,
+	}
+	jsonResponse(w, response, http.StatusCreated)
+}
+
+func (s *Server) AcceptFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFriendRequest(w, r)
+	if !ok {
+		return
+	}
+	err := s.db.AcceptFriendRequest(req.PlayerID, req.FriendID, s.clock.Now())
+	if errors.Is(err, database.ErrFriendRequestNotFound) {
+		http.Error(w, "Friend request not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.notify(req.FriendID, map[string]string{
+		"type": lobbyFriendAccepted,
+		"from": req.PlayerID,
+	})
+	response := map[string]string{
+		"message":  "Friend request accepted",
+		"friendId": req.FriendID,
+		"presence": s.presenceOf(req.FriendID),
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+func (s *Server) RemoveFriendHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFriendRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.RemoveFriend(req.PlayerID, req.FriendID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]string{
+		"message":  "Friend removed",
+		"friendId": req.FriendID,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+func (s *Server) BlockPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFriendRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.BlockPlayer(req.PlayerID, req.FriendID, s.clock.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]string{
+		"message":  "Player blocked",
+		"friendId": req.FriendID,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+func (s *Server) GetFriendsHandler(w http.ResponseWriter, r *http.Request) {
+	playerId := r.URL.Query().Get("playerId")
+	if playerId == "" {
+		http.Error(w, "Missing playerId", http.StatusBadRequest)
+		return
+	}
+	friends, err := s.db.GetFriends(playerId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := []map[string]interface{}{}
+	for _, friend := range friends {
+		entry := map[string]interface{}{
+			"playerId": friend.PlayerID,
+			"name":     friend.Name,
+			"status":   friend.Status,
+			"since":    friend.Since,
+		}
+		if friend.Status == database.FriendAccepted {
+			entry["presence"] = s.presenceOf(friend.PlayerID)
+		}
+		response = append(response, entry)
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
@@ -0,0 +1,119 @@
+package server
+
+import "time"
+
+// A running game is owned by a single goroutine: its own, runGame, or the game worker it was
+// placed on when games are sharded (see runShard). Only that goroutine touches the game and the
+// in-game state of its players: position, team, score, activity, disconnects and inputs.
+// Everyone else reaches the game through commands sent on its channel. mu only guards the
+// registry of games, the players' game IDs and the state players carry between games, and is
+// never held while waiting on a game, so games run independently of each other.
+
+// Commands a game buffers before senders have to wait for it
+const gameCommandBuffer = 256
+
+// Players that sent no input for inactivityTimeout are disconnected, checked every
+// inactivityCheckInterval
+const (
+	inactivityTimeout       = 30 * time.Second
+	inactivityCheckInterval = 10 * time.Second
+)
+
+// runGame is the game's goroutine. It ticks the game, checks for inactive players and runs the
+// commands sent to the game until the game ends.
+func (s *Server) runGame(game *Game) {
+	ticker := s.clock.NewTicker(tickInterval)
+	defer ticker.Stop()
+	inactivity := s.clock.NewTicker(inactivityCheckInterval)
+	defer inactivity.Stop()
+	for game.EndReason == "" {
+		select {
+		case now := <-ticker.C():
+			s.tickGame(game, now)
+		case now := <-inactivity.C():
+			s.checkPlayerInactivity(game, now)
+		case command := <-game.commands:
+			command()
+		}
+	}
+}
+
+// send hands the command to the game's goroutine. It reports false when the game has ended.
+func (g *Game) send(command func()) bool {
+	// A worker runs the commands of many games, skip those that reach it after the game ended
+	run := func() {
+		if g.EndReason == "" {
+			command()
+		}
+	}
+	select {
+	case g.commands <- run:
+		return true
+	case <-g.StopChan:
+		return false
+	}
+}
+
+// call runs fn on the game's goroutine and waits for it to finish. It reports false when the game
+// ended before running fn. Must not be called from a game's goroutine.
+func (g *Game) call(fn func()) bool {
+	done := make(chan struct{})
+	if !g.send(func() { fn(); close(done) }) {
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-g.StopChan:
+		// The game's goroutine closes StopChan after running its last command
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// input queues the player's input for the game's next tick.
+func (g *Game) input(player *Player, data []byte, now time.Time) {
+	g.send(func() {
+		player.LastActive = now
+		g.queueInput(player, data)
+	})
+}
+
+// leave tells the game the player disconnected. Their slot is released after the grace period.
+func (g *Game) leave(player *Player, now time.Time) {
+	g.send(func() {
+		player.Disconnected = true
+		player.DisconnectedAt = now
+	})
+}
+
+// addOpenSlots changes the game's open slots and publishes the new count to the matchmaker.
+// Must be called on the game's goroutine.
+func (g *Game) addOpenSlots(delta int) {
+	g.OpenSlots += delta
+	g.openSlots.Store(int64(g.OpenSlots))
+}
+
+// gameOf returns the game the player is in, or nil.
+func (s *Server) gameOf(player *Player) *Game {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeGames[player.GameID]
+}
+
+// publicGames returns the running games of the mode that aren't played in a private room.
+func (s *Server) publicGames(mode *GameMode) []*Game {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	games := []*Game{}
+	for _, game := range s.activeGames {
+		if game.Mode == mode.Name && !game.Private {
+			games = append(games, game)
+		}
+	}
+	return games
+}
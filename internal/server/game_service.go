@@ -2,10 +2,12 @@ package server
 
 import (
 	"encoding/json"
-	"log"
+	"game-server/internal/database"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,25 +15,100 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// Conn is the connection a player's inputs are read from and game updates are written to.
+// *websocket.Conn implements it for human players, botConn for bots.
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteJSON(v interface{}) error
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
 type Player struct {
-	Conn       *websocket.Conn
+	Conn       Conn
 	ID         string
 	LastActive time.Time
 	Name       string
+	Mode       string
+	GameID     string
+	IsBot      bool
+	// Decides the inputs of a bot, nil for human players
+	bot            Bot
+	QueuedAt       time.Time
+	Disconnected   bool
+	DisconnectedAt time.Time
+	// Latency in ms the client measured to each region
+	Latencies map[string]int
+	// Authoritative position, only changed by validated moves
+	X, Y       float64
+	LastMoveAt time.Time
+	Team       int
+	PartyID    string
+	// Private room the player queued for, if any
+	RoomID string
+	// Points scored in the current game
+	Score  int
+	Kills  int
+	Deaths int
+	// Accepted inputs per action, for rate limits and cooldowns
+	actionTimes  map[string][]time.Time
+	lastActionAt map[string]time.Time
+	chatTimes    []time.Time
+	mutedPlayers map[string]bool
+	// Violation score in the current game as of violationAt, and whether the session was kicked
+	// for cheating
+	violationScore float64
+	violationAt    time.Time
+	kicked         bool
+	// Chat messages most recently delivered to the player
+	recentChat []*ChatMessage
+	// Logger carrying the player's ID and mode
+	logger *slog.Logger
 }
 
 type Game struct {
 	ID        string
+	Mode      string
+	Region    string
+	RoomID    string
+	Private   bool
 	Players   []*Player
-	Ticker    *time.Ticker
+	OpenSlots int
+	// OpenSlots as last published by the game's goroutine, read by the matchmaker so it only
+	// offers players to games that can take them
+	openSlots atomic.Int64
+	// Closed once the game has ended
 	StopChan  chan struct{}
 	GameState map[string]interface{}
+	// Most recent chat messages, replayed to players that reconnect
+	ChatHistory []*ChatMessage
+	// Players whose slot was released after they disconnected, rated as losers when the game ends
+	Leavers   []*Player
+	StartedAt time.Time
+	// Why the game ended, set when it is closed
+	EndReason string
+	// Seed of the game's randomness, recorded in its replay
+	Seed int64
+	// Rand is the game's random source. Game logic draws from it so a match can be reproduced
+	// from its seed and inputs.
+	Rand *rand.Rand
+	// Ticks run since the game started
+	Tick int64
+	// Inputs received since the last tick
+	pendingInputs []queuedInput
+	// Time of the last tick and the time since then not yet run as fixed steps
+	lastTick    time.Time
+	accumulator time.Duration
+	// Commands run by the game's goroutine, and the worker running the game when games are sharded
+	commands chan func()
+	shard    *gameShard
+	// Replay being recorded, nil when replays are disabled
+	Replay     *replayRecorder
+	Spectators *spectatorHub
+	// Logger carrying the game's ID and mode
+	logger *slog.Logger
 }
 
-var playerQueue = make(chan *Player, 100)
-var activeGames = make(map[string]*Game)
-var mu sync.Mutex
-
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -44,6 +121,9 @@ func (s *Server) PlayerConnect(w http.ResponseWriter, r *http.Request) {
 	userId := r.URL.Query().Get("ID")
 	lastActiveStr := r.URL.Query().Get("LastActive")
 	name := r.URL.Query().Get("Name")
+	mode := r.URL.Query().Get("Mode")
+	latenciesStr := r.URL.Query().Get("Latencies")
+	roomId := r.URL.Query().Get("Room")
 	if userId == "" {
 		http.Error(w, "Missing userId", http.StatusBadRequest)
 		return
@@ -58,129 +138,499 @@ func (s *Server) PlayerConnect(w http.ResponseWriter, r *http.Request) {
 	}
 	lastActive, err := time.Parse(time.RFC3339, lastActiveStr)
 	if err != nil {
-		log.Printf("Error parsing LastActive: %v", err)
+		requestLogger(r).Warn("Invalid LastActive", "player_id", userId, "error", err)
 		http.Error(w, "Invalid LastActive timestamp", http.StatusBadRequest)
 		return
 	}
+	if roomId != "" {
+		if !s.roomMember(roomId, userId) {
+			http.Error(w, "Not invited to this room", http.StatusForbidden)
+			return
+		}
+		mode = s.roomMode(roomId)
+	}
+	if mode == "" {
+		mode = defaultMode
+	}
+	if _, ok := gameModes[mode]; !ok {
+		http.Error(w, "Unknown mode", http.StatusBadRequest)
+		return
+	}
+	latencies, err := parseLatencies(latenciesStr)
+	if err != nil {
+		http.Error(w, "Invalid Latencies: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Answers most duplicates before upgrading, registerClient makes the final call
+	if duplicateSessionPolicy == rejectDuplicateSessions && s.connectedClient(userId) != nil {
+		http.Error(w, "Player already connected", http.StatusConflict)
+		return
+	}
+	logger := requestLogger(r).With("player_id", userId, "mode", mode)
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Error upgrading connection: ", err)
+		logger.Error("Error upgrading connection", "error", err)
 		return
 	}
-	player := &Player{Conn: ws, ID: userId, Name: name, LastActive: lastActive}
-	playerQueue <- player
-	log.Printf("Player %s %s connected", player.ID, player.Name)
-
+	if sanction := s.activeSanction(userId, database.SanctionBan, database.SanctionSuspension, database.SanctionMatchmakingCooldown); sanction != nil {
+		rejectSanctioned(logger, ws, sanction)
+		return
+	}
+	player := &Player{Conn: s.newConn(ws), ID: userId, Name: name, LastActive: lastActive, Mode: mode, QueuedAt: s.clock.Now(), Latencies: latencies, PartyID: s.partyOf(userId), RoomID: roomId, logger: logger}
+	player.mutedPlayers = s.loadMutes(userId)
+	previous, err := s.registerClient(player)
+	if err != nil {
+		logger.Info("Player rejected", "error", err)
+		kickPlayer(player, "Player already connected")
+		return
+	}
+	if previous == nil {
+		// A socket that dropped during a game gets its slot back within the grace period
+		previous = s.droppedSession(userId)
+	}
 	go func() {
-		for {
-			_, _, err := ws.ReadMessage()
-			if err != nil {
-				log.Println("Error reading message:", err)
-				break
+		s.readPlayerInput(player)
+		s.unregisterClient(player)
+		s.notifyPresence(player.ID)
+	}()
+	if previous != nil && s.supersedeSession(previous, player) {
+		s.notifyPresence(player.ID)
+		return
+	}
+	s.playerQueue <- player
+	logger.Info("Player connected", "name", player.Name)
+	s.notifyPresence(player.ID)
+}
+
+// readPlayerInput processes inputs from a player's connection until it is closed.
+// Human players and bots share this path.
+func (s *Server) readPlayerInput(player *Player) {
+	for {
+		_, message, err := player.Conn.ReadMessage()
+		if err != nil {
+			player.logger.Debug("Stopped reading player", "error", err)
+			break
+		}
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(message, &envelope)
+		switch envelope.Type {
+		case messageTypeChat:
+			s.handleChat(player, message)
+		case messageTypeMute, messageTypeUnmute:
+			s.handleMute(player, envelope.Type, message)
+		case messageTypeReport:
+			s.handleReport(player, message)
+		default:
+			// Inputs are applied by the player's game on its next tick, in simulated time. Outside
+			// of a game there is nothing to apply them to.
+			if game := s.gameOf(player); game != nil {
+				game.input(player, message, s.clock.Now())
 			}
-			mu.Lock()
-			player.LastActive = time.Now()
-			mu.Unlock()
 		}
-	}()
+	}
+	// Once the player is in a game, the game owns their connection state
+	s.mu.Lock()
+	game := s.activeGames[player.GameID]
+	if game == nil {
+		player.Disconnected = true
+		player.DisconnectedAt = s.clock.Now()
+	} else {
+		s.droppedSessions[player.ID] = player
+	}
+	s.mu.Unlock()
+	if game != nil {
+		game.leave(player, s.clock.Now())
+	}
 }
 
 func (s *Server) Matchmaking() {
-	log.Println("********* Matchmaking active *********")
+	slog.Info("Matchmaking active")
 
+	// Players waiting for a match, per mode or private room. Only touched by this goroutine.
+	waiting := make(map[string][]*Player)
 	for {
-		if len(playerQueue) >= 6 {
-			players := make([]*Player, 6)
-			for i := 0; i < 6; i++ {
-				players[i] = <-playerQueue
+		now := s.clock.Now()
+		s.expireLobbyState(now)
+		s.drainPlayerQueue(waiting)
+		s.startRooms(waiting)
+		for name, mode := range gameModes {
+			queued := waiting[name]
+			if mode.Backfill {
+				queued = s.backfillGames(mode, queued, now)
+			}
+			if mode.ReplaceLeavers {
+				s.replaceLeaversWithBots(mode)
+			}
+			for {
+				region, players := findRegionMatch(mode, queued, now)
+				if players == nil {
+					break
+				}
+				queued = removePlayers(queued, players)
+				go s.StartMatch(mode, region, players)
 			}
-			go s.StartMatch(players)
+			// Nobody else showed up in time, fill the match with bots
+			if region, players := botFillMatch(mode, queued, now); players != nil {
+				queued = removePlayers(queued, players)
+				slog.Info("Filling match with bots", "mode", mode.Name, "bots", mode.MatchSize-len(players))
+				for len(players) < mode.MatchSize {
+					players = append(players, s.newBot(mode))
+				}
+				go s.StartMatch(mode, region, players)
+			}
+			waiting[name] = queued
 		}
-		time.Sleep(100 * time.Millisecond)
+		s.metrics.setQueueDepths(waiting)
+		s.clock.Sleep(100 * time.Millisecond)
 	}
 }
 
-func (s *Server) StartMatch(players []*Player) {
-	gameId := uuid.New().String()
-	stopChan := make(chan struct{})
-	ticker := time.NewTicker(16 * time.Millisecond)
-	playerNames := []string{}
+// drainPlayerQueue moves newly connected players into the per-mode waiting lists, turning away
+// players on a matchmaking cooldown, and drops players that disconnected while waiting.
+func (s *Server) drainPlayerQueue(waiting map[string][]*Player) {
+	for len(s.playerQueue) > 0 {
+		player := <-s.playerQueue
+		if sanction := s.activeSanction(player.ID, database.SanctionMatchmakingCooldown); sanction != nil {
+			player.logger.Info("Player is on a matchmaking cooldown")
+			kickPlayer(player, sanctionCloseReason(*sanction))
+			continue
+		}
+		waiting[player.queueKey()] = append(waiting[player.queueKey()], player)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for mode, queued := range waiting {
+		connected := queued[:0]
+		for _, player := range queued {
+			if player.Disconnected {
+				player.logger.Info("Player left the queue")
+				continue
+			}
+			connected = append(connected, player)
+		}
+		waiting[mode] = connected
+	}
+}
+
+// backfillGames places queued players into running games of the mode that have open slots.
+// It returns the players that are still waiting.
+func (s *Server) backfillGames(mode *GameMode, queued []*Player, now time.Time) []*Player {
+	if len(queued) == 0 {
+		return queued
+	}
+
+	games := s.publicGames(mode)
+	remaining := []*Player{}
+	for _, player := range queued {
+		if !s.backfill(games, player, now) {
+			remaining = append(remaining, player)
+		}
+	}
+	return remaining
+}
+
+// backfill offers the player to the games in a region they accept that publish an open slot,
+// until one takes them. Games without open slots aren't asked, so the matchmaker only waits on
+// games that can place the player. It reports whether the player left the queue, which they also do when they can't
+// be sent the game's snapshot.
+func (s *Server) backfill(games []*Game, player *Player, now time.Time) bool {
+	for _, game := range games {
+		if game.openSlots.Load() == 0 || !player.acceptsRegion(game.Region, now) {
+			continue
+		}
+		placed, joined := false, false
+		var players string
+		game.call(func() {
+			if game.EndReason != "" || game.OpenSlots == 0 {
+				return
+			}
+			placed = true
+			joined = s.joinGame(game, player)
+			players = historyPlayers(game.Players)
+		})
+		if joined {
+			s.metrics.observeQueueWait(player, now)
+			s.recordJoins(game, []*Player{player}, players)
+		}
+		if placed {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceLeaversWithBots has the running games of the mode fill their open slots with bots.
+func (s *Server) replaceLeaversWithBots(mode *GameMode) {
+	for _, game := range s.publicGames(mode) {
+		if game.openSlots.Load() == 0 {
+			continue
+		}
+		game.send(func() {
+			bots := []*Player{}
+			for game.EndReason == "" && game.OpenSlots > 0 {
+				bot := s.newBot(mode)
+				if !s.joinGame(game, bot) {
+					break
+				}
+				game.playerLogger(bot).Info("Bot replaced a leaver")
+				bots = append(bots, bot)
+			}
+			if len(bots) > 0 {
+				s.recordJoins(game, bots, historyPlayers(game.Players))
+			}
+		})
+	}
+}
+
+// recordJoins stores the players that joined a running game in the game history.
+func (s *Server) recordJoins(game *Game, joined []*Player, players string) {
+	if err := s.db.UpdateGamePlayers(game.ID, players); err != nil {
+		game.logger.Error("Error updating game players", "error", err)
+	}
+	now := s.clock.Now()
+	for _, player := range joined {
+		if err := s.db.StoreGameParticipant(game.ID, player.ID, player.Name, player.IsBot, now); err != nil {
+			game.playerLogger(player).Error("Error storing game participant", "error", err)
+		}
+		if !player.IsBot {
+			s.notifyPresence(player.ID)
+		}
+	}
+}
+
+// joinGame adds a player to a running game and sends them a full snapshot of the game state.
+// Must be called on the game's goroutine.
+func (s *Server) joinGame(game *Game, player *Player) bool {
+	player.Team = smallestTeam(game)
+	s.mu.Lock()
+	chat := game.chatHistoryFor(player)
+	s.mu.Unlock()
+	err := player.Conn.WriteJSON(map[string]interface{}{
+		"gameId":   game.ID,
+		"region":   game.Region,
+		"team":     player.Team,
+		"message":  "Joined game in progress",
+		"players":  playerNames(game.Players),
+		"snapshot": game.GameState,
+		"chat":     chat,
+	})
+	if err != nil {
+		game.playerLogger(player).Warn("Error sending snapshot", "error", err)
+		player.Conn.Close()
+		return false
+	}
+	s.mu.Lock()
+	player.GameID = game.ID
+	s.mu.Unlock()
+	player.LastActive = s.clock.Now()
+	player.violationScore, player.violationAt = 0, time.Time{}
+	game.spawn(player)
+	game.Players = append(game.Players, player)
+	game.Replay.recordJoin(game.Tick, player)
+	game.addOpenSlots(-1)
+	game.playerLogger(player).Info("Player joined game in progress")
+	return true
+}
+
+// smallestTeam returns the team with the fewest players, where a joining player is placed.
+// Must be called on the game's goroutine.
+func smallestTeam(game *Game) int {
+	counts := make([]int, gameModes[game.Mode].Teams)
+	for _, player := range game.Players {
+		counts[player.Team]++
+	}
+	team := 0
+	for i, count := range counts {
+		if count < counts[team] {
+			team = i
+		}
+	}
+	return team
+}
+
+func playerNames(players []*Player) string {
+	names := []string{}
 	for _, player := range players {
-		playerNames = append(playerNames, player.Name)
+		names = append(names, player.Name)
 	}
+	return strings.Join(names, ",")
+}
+
+// historyPlayers lists the humans among the players for the game history. Bots are only recorded
+// as flagged game participants, so history consumers can't mistake them for players.
+func historyPlayers(players []*Player) string {
+	humans := []*Player{}
+	for _, player := range players {
+		if !player.IsBot {
+			humans = append(humans, player)
+		}
+	}
+	return playerNames(humans)
+}
+
+func (s *Server) StartMatch(mode *GameMode, region string, players []*Player) {
+	gameId := uuid.New().String()
+	seed := rand.Int63()
+	now := s.clock.Now()
+	logger := slog.With("game_id", gameId, "mode", mode.Name)
 	// Add game to the game_history table when the game starts
-	playersStr := strings.Join(playerNames, ",")
-	err := s.db.StoreGameHistory(gameId, playersStr, "in-progress")
+	playersStr := playerNames(players)
+	err := s.db.StoreGameHistory(gameId, historyPlayers(players), "in-progress", now)
 	if err != nil {
-		log.Printf("Error storing game history: %v", err)
+		logger.Error("Error storing game history", "error", err)
+	}
+	for _, player := range players {
+		err := s.db.StoreGameParticipant(gameId, player.ID, player.Name, player.IsBot, now)
+		if err != nil {
+			logger.Error("Error storing game participant", "player_id", player.ID, "error", err)
+		}
 	}
 	game := &Game{
-		ID:       gameId,
-		Players:  players,
-		Ticker:   ticker,
-		StopChan: stopChan,
+		ID:         gameId,
+		Mode:       mode.Name,
+		Region:     region,
+		RoomID:     players[0].RoomID,
+		Private:    players[0].RoomID != "",
+		Players:    players,
+		StopChan:   make(chan struct{}),
+		StartedAt:  now,
+		Seed:       seed,
+		Rand:       newGameRand(seed),
+		Spectators: newSpectatorHub(mode.SpectatorDelay),
+		lastTick:   now,
+		logger:     logger,
 	}
 
-	mu.Lock()
-	activeGames[gameId] = game
-	mu.Unlock()
+	// The game isn't running yet, so its players can be set up here
+	for i, player := range players {
+		player.Team = i % mode.Teams
+		player.LastActive = now
+		player.violationScore, player.violationAt = 0, time.Time{}
+		game.spawn(player)
+		s.metrics.observeQueueWait(player, now)
+	}
+	game.Replay = newReplayRecorder(game)
+	s.placeGame(game)
 
-	log.Printf("Starting game %s with players: %v\n", gameId, players)
+	logger.Info("Starting game", "region", region, "players", playersStr)
 
 	for _, player := range players {
-		err := player.Conn.WriteJSON(map[string]string{
+		err := player.Conn.WriteJSON(map[string]interface{}{
 			"gameId":  gameId,
+			"region":  region,
+			"team":    player.Team,
 			"message": "Game has started",
 		})
 		if err != nil {
-			log.Printf("Error sending game Id to player %s: %v", player.ID, err)
+			game.playerLogger(player).Warn("Error sending game ID", "error", err)
 			player.Conn.Close()
 		}
 	}
 
-	go checkPlayerInactivity(players, game.StopChan)
-	go gameTickerLoop(game, ticker, game.StopChan)
+	s.mu.Lock()
+	for _, player := range players {
+		player.GameID = gameId
+	}
+	s.activeGames[gameId] = game
+	s.mu.Unlock()
+
+	for _, player := range players {
+		if !player.IsBot {
+			s.notifyPresence(player.ID)
+		}
+	}
+
+	s.startGame(game)
 }
 
-func checkPlayerInactivity(players []*Player, stopChan chan struct{}) {
-	inactivityTimeout := 30 * time.Second
-	for {
-		select {
-		case <-time.After(10 * time.Second):
-			mu.Lock()
-			for _, player := range players {
-				if time.Since(player.LastActive) > inactivityTimeout {
-					log.Printf("Player %s is inactive, disconnecting...", player.ID)
-					player.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Disconnected due to inactivity"))
-					player.Conn.Close()
-				}
-			}
-			mu.Unlock()
-		case <-stopChan:
-			return
+// checkPlayerInactivity disconnects players that stopped sending inputs and releases the slots of
+// players that have been gone for the grace period. Must be called on the game's goroutine.
+func (s *Server) checkPlayerInactivity(game *Game, now time.Time) {
+	for _, player := range game.Players {
+		if !player.Disconnected && now.Sub(player.LastActive) > inactivityTimeout {
+			game.playerLogger(player).Info("Player is inactive, disconnecting")
+			player.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Disconnected due to inactivity"))
+			player.Conn.Close()
 		}
 	}
+	leavers := releaseDisconnectedSlots(game, now)
+	if len(leavers) > 0 {
+		s.mu.Lock()
+		s.forgetDroppedSessions(leavers)
+		s.mu.Unlock()
+		if err := s.db.UpdateGamePlayers(game.ID, historyPlayers(game.Players)); err != nil {
+			game.logger.Error("Error updating game players", "error", err)
+		}
+	}
+	for _, player := range leavers {
+		s.recordAbandon(game, player, now)
+	}
 }
 
-func gameTickerLoop(game *Game, ticker *time.Ticker, stopChan chan struct{}) {
-	for {
-		select {
-		case <-ticker.C:
-			game.GameState = getGameState(game.ID)
-			for _, player := range game.Players {
-				err := player.Conn.WriteJSON(game.GameState)
-				if err != nil {
-					player.Conn.Close()
-				}
-			}
-		case <-stopChan:
-			log.Printf("Closing game %s", game.ID)
-			for _, player := range game.Players {
-				player.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Game over"))
-				player.Conn.Close()
-			}
-			ticker.Stop()
-			return
+// releaseDisconnectedSlots removes players that have been disconnected for longer than the
+// grace period and declares their slots open. It returns the players that left.
+// Must be called on the game's goroutine.
+func releaseDisconnectedSlots(game *Game, now time.Time) []*Player {
+	remaining := make([]*Player, 0, len(game.Players))
+	leavers := []*Player{}
+	for _, player := range game.Players {
+		if player.gone(now) {
+			game.playerLogger(player).Info("Player left game, slot is now open")
+			game.addOpenSlots(1)
+			leavers = append(leavers, player)
+			game.Leavers = append(game.Leavers, player)
+			game.Replay.recordLeave(game.Tick, player)
+			continue
+		}
+		remaining = append(remaining, player)
+	}
+	game.Players = remaining
+	return leavers
+}
+
+// tickGame runs as many fixed steps of tickInterval as the time since the last tick covers and
+// sends the state to the players, or ends the game once an end condition is met.
+// Must be called on the game's goroutine.
+func (s *Server) tickGame(game *Game, now time.Time) {
+	defer s.metrics.observeTick(time.Now())
+	// Run as many fixed ticks as the time since the last wake up covers
+	game.accumulator += now.Sub(game.lastTick)
+	game.lastTick = now
+	steps := 0
+	reason := ""
+	for game.accumulator >= tickInterval && steps < maxCatchUpTicks && reason == "" {
+		s.stepGame(game)
+		game.accumulator -= tickInterval
+		steps++
+		reason = endCondition(game, now)
+	}
+	if game.accumulator >= tickInterval {
+		game.logger.Warn("Game fell behind, skipping ahead", "behind", game.accumulator)
+		game.accumulator = 0
+	}
+	if reason != "" {
+		// Players who are gone are leavers, not finishers, and no one is backfilled any more
+		game.EndReason = reason
+		for _, player := range releaseDisconnectedSlots(game, now) {
+			s.recordAbandon(game, player, now)
+		}
+		s.closeGame(game, reason)
+		return
+	}
+	// Delayed snapshots come due even on wake ups that run no tick
+	defer game.Spectators.flush(now)
+	if steps == 0 {
+		return
+	}
+	game.GameState = getGameState(game)
+	game.Spectators.publish(game.GameState, now)
+	for _, player := range game.Players {
+		err := player.Conn.WriteJSON(game.GameState)
+		if err != nil {
+			player.Conn.Close()
 		}
 	}
 }
@@ -189,16 +639,16 @@ func (s *Server) CloseGameHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameId := vars["gameId"]
 
-	mu.Lock()
-	_, exists := activeGames[gameId]
-	mu.Unlock()
+	s.mu.Lock()
+	_, exists := s.activeGames[gameId]
+	s.mu.Unlock()
 
 	if !exists {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
 	}
 
-	s.CloseGame(gameId)
+	s.CloseGame(gameId, database.EndAdminClosed)
 
 	response := map[string]string{
 		"message": "Game closed successfully",
@@ -207,33 +657,81 @@ func (s *Server) CloseGameHandler(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, response, http.StatusOK)
 }
 
-func (s *Server) CloseGame(gameId string) {
-	mu.Lock()
-	game, exists := activeGames[gameId]
+// CloseGame ends the game for the reason and waits until it is closed.
+func (s *Server) CloseGame(gameId, reason string) {
+	s.mu.Lock()
+	game, exists := s.activeGames[gameId]
+	s.mu.Unlock()
 
 	if exists {
-		for _, player := range game.Players {
-			player.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Game over"))
-			player.Conn.Close()
-		}
-		close(game.StopChan)
-		// Update game result and end time in the game_history table
-		err := s.db.UpdateGameResult(gameId, "finished")
-		if err != nil {
-			log.Printf("Error updating game result: %v", err)
+		game.call(func() { s.closeGame(game, reason) })
+	}
+}
+
+// closeGame ends the game for the reason, sending its players the result before closing their
+// sockets. Must be called on the game's goroutine, which stops afterwards.
+func (s *Server) closeGame(game *Game, reason string) {
+	game.EndReason = reason
+	game.openSlots.Store(0)
+	now := s.clock.Now()
+	result := buildGameResult(game, reason, now)
+	gameOver := map[string]interface{}{
+		"type":   messageTypeGameOver,
+		"result": result,
+	}
+	for _, player := range game.Players {
+		if err := player.Conn.WriteJSON(gameOver); err != nil {
+			game.playerLogger(player).Warn("Error sending result", "error", err)
 		}
-		delete(activeGames, gameId)
-		log.Printf("Game %s has been closed", gameId)
+		player.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Game over"))
+		player.Conn.Close()
+	}
+	game.Spectators.close()
+	if game.Replay != nil {
+		game.Replay.recordKeyframe(game.Tick, getGameState(game))
+		s.storeReplay(game)
+	}
+	if err := s.db.StoreGameResult(*result); err != nil {
+		game.logger.Error("Error storing game result", "error", err)
 	}
-	mu.Unlock()
+	if err := s.db.RecordGameStats(game.ID, game.Mode, statsResults(result), now); err != nil {
+		game.logger.Error("Error recording game stats", "error", err)
+	}
+	s.updateRatings(game, now)
+	// Update game result and end time in the game_history table
+	err := s.db.UpdateGameResult(game.ID, reason, now)
+	if err != nil {
+		game.logger.Error("Error updating game history", "error", err)
+	}
+	s.mu.Lock()
+	delete(s.activeGames, game.ID)
+	s.forgetDroppedSessions(game.Players)
+	s.forgetDroppedSessions(game.Leavers)
+	s.mu.Unlock()
+	if game.RoomID != "" {
+		s.mutex.Lock()
+		delete(s.rooms, game.RoomID)
+		s.mutex.Unlock()
+	}
+	close(game.StopChan)
+	game.logger.Info("Game has been closed", "reason", reason)
 }
 
-func getGameState(gameId string) map[string]interface{} {
+// getGameState builds the state update sent to players. Must be called on the game's goroutine.
+func getGameState(game *Game) map[string]interface{} {
+	positions := make(map[string]interface{})
+	scores := make(map[string]int)
+	for _, player := range game.Players {
+		positions[player.ID] = map[string]float64{"x": player.X, "y": player.Y}
+		scores[player.ID] = player.Score
+	}
 	return map[string]interface{}{
-		"gameId":  gameId,
-		"state":   "active",
-		"tick":    time.Now().Unix(),
-		"message": "Game state update",
+		"gameId":    game.ID,
+		"state":     "active",
+		"tick":      game.Tick,
+		"message":   "Game state update",
+		"positions": positions,
+		"scores":    scores,
 	}
 }
 
@@ -241,7 +739,7 @@ func jsonResponse(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+		slog.Error("Error encoding JSON response", "error", err)
 	}
 }
 
@@ -252,7 +750,7 @@ func (s *Server) CreatePlayerHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	s.db.StorePlayer(player.ID, player.Name)
+	s.db.StorePlayer(player.ID, player.Name, s.clock.Now())
 	response := map[string]string{
 		"message":  "PLayer created successfully",
 		"playerId": player.ID,
@@ -0,0 +1,446 @@
+package server
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How long an invite can be accepted
+const inviteTTL = 5 * time.Minute
+
+const maxPartySize = 6
+
+const roomQueuePrefix = "room:"
+
+// Invite kinds
+const (
+	invitePartyKind = "party"
+	inviteGameKind  = "game"
+)
+
+type Party struct {
+	ID       string          `json:"id"`
+	LeaderID string          `json:"leaderId"`
+	Members  map[string]bool `json:"members"`
+}
+
+// Room is a private room players are invited to. Its members queue with the Room query
+// parameter and are matched only with each other.
+type Room struct {
+	ID      string          `json:"id"`
+	HostID  string          `json:"hostId"`
+	Mode    string          `json:"mode"`
+	Members map[string]bool `json:"members"`
+	// Ready is set by the host to start the match with whoever is queued, filling up with bots
+	Ready bool `json:"ready"`
+	// Started rooms are kept while their game runs so members can spectate it
+	Started bool `json:"started"`
+	// Rooms that haven't started by then are closed, pushed back by every invite and join
+	expiresAt time.Time
+}
+
+type Invite struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	From      string    `json:"from"`
+	FromName  string    `json:"fromName"`
+	To        string    `json:"to"`
+	TargetID  string    `json:"targetId"`
+	Mode      string    `json:"mode,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// partyOf returns the ID of the player's party, or "" if they aren't in one.
+func (s *Server) partyOf(playerId string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.partyByPlayer[playerId]
+}
+
+// roomMember reports whether the player was invited to the room.
+func (s *Server) roomMember(roomId, playerId string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	room, ok := s.rooms[roomId]
+	return ok && room.Members[playerId]
+}
+
+// roomMode returns the mode the room is played in.
+func (s *Server) roomMode(roomId string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if room, ok := s.rooms[roomId]; ok {
+		return room.Mode
+	}
+	return ""
+}
+
+// queueKey is the waiting list the matchmaker keeps the player in: their private room or their mode.
+func (p *Player) queueKey() string {
+	if p.RoomID != "" {
+		return roomQueuePrefix + p.RoomID
+	}
+	return p.Mode
+}
+
+// startRooms starts private rooms whose host is ready or that have enough members queued.
+// Members queued for a room that has already started are turned away.
+func (s *Server) startRooms(waiting map[string][]*Player) {
+	for key, queued := range waiting {
+		roomId, isRoom := strings.CutPrefix(key, roomQueuePrefix)
+		if !isRoom || len(queued) == 0 {
+			continue
+		}
+		s.mutex.Lock()
+		room, ok := s.rooms[roomId]
+		ok = ok && !room.Started
+		var mode *GameMode
+		start := false
+		if ok {
+			mode = gameModes[room.Mode]
+			start = room.Ready || len(queued) >= mode.MatchSize
+			room.Started = start
+		}
+		s.mutex.Unlock()
+
+		if !ok {
+			for _, player := range queued {
+				kickPlayer(player, "Room is no longer available")
+			}
+			delete(waiting, key)
+			continue
+		}
+		if !start {
+			continue
+		}
+		players := queued
+		if len(players) > mode.MatchSize {
+			players = players[:mode.MatchSize]
+			for _, player := range queued[mode.MatchSize:] {
+				kickPlayer(player, "Room is full")
+			}
+		}
+		players = append([]*Player(nil), players...)
+		slog.Info("Starting private room", "room_id", roomId, "mode", mode.Name, "bots", mode.MatchSize-len(players))
+		for len(players) < mode.MatchSize {
+			players = append(players, s.newBot(mode))
+		}
+		delete(waiting, key)
+		go s.StartMatch(mode, bestRegion(players), players)
+	}
+}
+
+// pendingInvites returns the unexpired invites sent to the player. Must be called with s.mutex held.
+func (s *Server) pendingInvites(playerId string) []*Invite {
+	invites := []*Invite{}
+	now := s.clock.Now()
+	for id, invite := range s.invites {
+		if now.After(invite.ExpiresAt) {
+			delete(s.invites, id)
+			continue
+		}
+		if invite.To == playerId {
+			invites = append(invites, invite)
+		}
+	}
+	return invites
+}
+
+func (s *Server) inviteToParty(client *LobbyClient, to string) {
+	if to == "" || to == client.ID {
+		s.notifyError(client.ID, "Invalid invitee")
+		return
+	}
+	s.mutex.Lock()
+	partyId, ok := s.partyByPlayer[client.ID]
+	if !ok {
+		partyId = uuid.New().String()
+		s.parties[partyId] = &Party{ID: partyId, LeaderID: client.ID, Members: map[string]bool{client.ID: true}}
+		s.partyByPlayer[client.ID] = partyId
+	}
+	full := len(s.parties[partyId].Members) >= maxPartySize
+	var invite *Invite
+	if !full {
+		invite = s.createInvite(client, to, invitePartyKind, partyId, "")
+	}
+	s.mutex.Unlock()
+
+	if full {
+		s.notifyError(client.ID, "Party is full")
+		return
+	}
+	if !ok {
+		s.setSessionParty(client.ID, partyId)
+	}
+	s.notify(to, map[string]interface{}{
+		"type":   lobbyPartyInvite,
+		"invite": invite,
+	})
+}
+
+func (s *Server) inviteToGame(client *LobbyClient, to, mode string) {
+	if to == "" || to == client.ID {
+		s.notifyError(client.ID, "Invalid invitee")
+		return
+	}
+	s.mutex.Lock()
+	var room *Room
+	for _, r := range s.rooms {
+		if r.HostID == client.ID && !r.Started {
+			room = r
+			break
+		}
+	}
+	if room == nil {
+		if mode == "" {
+			mode = defaultMode
+		}
+		if _, ok := gameModes[mode]; !ok {
+			s.mutex.Unlock()
+			s.notifyError(client.ID, "Unknown mode")
+			return
+		}
+		room = &Room{ID: uuid.New().String(), HostID: client.ID, Mode: mode, Members: map[string]bool{client.ID: true}}
+		s.rooms[room.ID] = room
+	}
+	invite := s.createInvite(client, to, inviteGameKind, room.ID, room.Mode)
+	room.expiresAt = invite.ExpiresAt
+	roomId, roomMode := room.ID, room.Mode
+	s.mutex.Unlock()
+
+	s.notify(client.ID, map[string]interface{}{
+		"type":   lobbyRoomJoined,
+		"roomId": roomId,
+		"mode":   roomMode,
+	})
+	s.notify(to, map[string]interface{}{
+		"type":   lobbyGameInvite,
+		"invite": invite,
+	})
+}
+
+// createInvite must be called with s.mutex held.
+func (s *Server) createInvite(from *LobbyClient, to, kind, targetId, mode string) *Invite {
+	invite := &Invite{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		From:      from.ID,
+		FromName:  from.Name,
+		To:        to,
+		TargetID:  targetId,
+		Mode:      mode,
+		ExpiresAt: s.clock.Now().Add(inviteTTL),
+	}
+	s.invites[invite.ID] = invite
+	from.logger.Info("Player sent an invite", "to", to, "kind", kind, "target_id", targetId)
+	return invite
+}
+
+// takeInvite removes and returns the player's unexpired invite. Must be called with s.mutex held.
+func (s *Server) takeInvite(playerId, inviteId string) *Invite {
+	invite, ok := s.invites[inviteId]
+	if !ok || invite.To != playerId {
+		return nil
+	}
+	delete(s.invites, inviteId)
+	if s.clock.Now().After(invite.ExpiresAt) {
+		return nil
+	}
+	return invite
+}
+
+func (s *Server) acceptInvite(client *LobbyClient, inviteId string) {
+	s.mutex.Lock()
+	invite := s.takeInvite(client.ID, inviteId)
+	if invite == nil {
+		s.mutex.Unlock()
+		s.notifyError(client.ID, "Invite not found or expired")
+		return
+	}
+
+	switch invite.Kind {
+	case invitePartyKind:
+		party, ok := s.parties[invite.TargetID]
+		if !ok || len(party.Members) >= maxPartySize {
+			s.mutex.Unlock()
+			s.notifyError(client.ID, "Party is no longer available")
+			return
+		}
+		if party.Members[client.ID] {
+			s.mutex.Unlock()
+			return
+		}
+		// Leaving the old party and joining the new one happen at once, so neither can be
+		// disbanded halfway through
+		oldPartyId, oldMembers, _ := s.leavePartyLocked(client.ID)
+		party.Members[client.ID] = true
+		s.partyByPlayer[client.ID] = party.ID
+		members := partyMembers(party)
+		s.mutex.Unlock()
+
+		s.setSessionParty(client.ID, party.ID)
+		s.notifyParty(oldPartyId, oldMembers)
+		s.notifyParty(party.ID, members)
+	case inviteGameKind:
+		room, ok := s.rooms[invite.TargetID]
+		if !ok || room.Started {
+			s.mutex.Unlock()
+			s.notifyError(client.ID, "Game is no longer available")
+			return
+		}
+		room.Members[client.ID] = true
+		room.expiresAt = s.clock.Now().Add(inviteTTL)
+		roomId, mode := room.ID, room.Mode
+		s.mutex.Unlock()
+
+		s.notify(client.ID, map[string]interface{}{
+			"type":   lobbyRoomJoined,
+			"roomId": roomId,
+			"mode":   mode,
+		})
+	}
+}
+
+func (s *Server) declineInvite(client *LobbyClient, inviteId string) {
+	s.mutex.Lock()
+	invite := s.takeInvite(client.ID, inviteId)
+	s.mutex.Unlock()
+	if invite == nil {
+		s.notifyError(client.ID, "Invite not found or expired")
+		return
+	}
+	s.notify(invite.From, map[string]interface{}{
+		"type":     lobbyInviteDeclined,
+		"inviteId": invite.ID,
+		"by":       client.ID,
+	})
+}
+
+// leaveParty removes the player from their party, disbanding it once it's empty.
+func (s *Server) leaveParty(playerId string) {
+	s.mutex.Lock()
+	partyId, members, ok := s.leavePartyLocked(playerId)
+	s.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	s.setSessionParty(playerId, "")
+	s.notifyParty(partyId, members)
+}
+
+// leavePartyLocked removes the player from their party, disbanding it once it's empty, and
+// returns the party and the members left. ok is false if the player wasn't in a party.
+// Must be called with s.mutex held.
+func (s *Server) leavePartyLocked(playerId string) (partyId string, members []string, ok bool) {
+	partyId, ok = s.partyByPlayer[playerId]
+	if !ok {
+		return "", nil, false
+	}
+	party := s.parties[partyId]
+	delete(party.Members, playerId)
+	delete(s.partyByPlayer, playerId)
+	if len(party.Members) == 0 {
+		delete(s.parties, partyId)
+	} else if party.LeaderID == playerId {
+		for member := range party.Members {
+			party.LeaderID = member
+			break
+		}
+	}
+	return partyId, partyMembers(party), true
+}
+
+// notifyParty sends the party's members its member list.
+func (s *Server) notifyParty(partyId string, members []string) {
+	for _, member := range members {
+		s.notify(member, map[string]interface{}{
+			"type":    lobbyPartyUpdate,
+			"partyId": partyId,
+			"members": members,
+		})
+	}
+}
+
+// expireLobbyState drops expired invites, the rooms that weren't started in time and the parties
+// nobody joined.
+func (s *Server) expireLobbyState(now time.Time) {
+	s.mutex.Lock()
+	invited := make(map[string]bool)
+	for id, invite := range s.invites {
+		if now.After(invite.ExpiresAt) {
+			delete(s.invites, id)
+			continue
+		}
+		invited[invite.TargetID] = true
+	}
+	for id, room := range s.rooms {
+		if !room.Started && now.After(room.expiresAt) {
+			delete(s.rooms, id)
+		}
+	}
+	disbanded := []string{}
+	for id, party := range s.parties {
+		if len(party.Members) > 1 || invited[id] {
+			continue
+		}
+		for member := range party.Members {
+			delete(s.partyByPlayer, member)
+			disbanded = append(disbanded, member)
+		}
+		delete(s.parties, id)
+	}
+	s.mutex.Unlock()
+
+	for _, member := range disbanded {
+		s.setSessionParty(member, "")
+	}
+}
+
+// closeHostedRooms closes the rooms the player hosts that haven't started. Members queued for
+// them are turned away by the matchmaker. Must be called with s.mutex held.
+func (s *Server) closeHostedRooms(playerId string) {
+	for id, room := range s.rooms {
+		if room.HostID == playerId && !room.Started {
+			delete(s.rooms, id)
+		}
+	}
+}
+
+// startRoom marks the host's room ready so the matchmaker starts it with whoever is queued.
+func (s *Server) startRoom(client *LobbyClient) {
+	s.mutex.Lock()
+	started := false
+	for _, room := range s.rooms {
+		if room.HostID == client.ID && !room.Started {
+			room.Ready = true
+			started = true
+		}
+	}
+	s.mutex.Unlock()
+	if !started {
+		s.notifyError(client.ID, "You are not hosting a room")
+	}
+}
+
+// setSessionParty updates the party of the player's match session, if they have one.
+func (s *Server) setSessionParty(playerId, partyId string) {
+	sessions := s.chatSessions(playerId)
+	s.mu.Lock()
+	for _, session := range sessions {
+		session.PartyID = partyId
+	}
+	s.mu.Unlock()
+}
+
+// partyMembers must be called with s.mutex held.
+func partyMembers(party *Party) []string {
+	members := []string{}
+	for member := range party.Members {
+		members = append(members, member)
+	}
+	return members
+}
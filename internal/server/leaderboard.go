@@ -0,0 +1,284 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"game-server/internal/database"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Elo K factor, the most rating points a single game can move
+var ratingK = envInt("RATING_K", 32)
+
+// Fraction of their distance to the default rating players keep when a season ends
+var seasonResetFactor = envFloat("SEASON_RESET_FACTOR", 0.5)
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+	defaultNeighbours       = 5
+	maxNeighbours           = 50
+)
+
+// updateRatings rates the humans of a finished game on its mode's and the global leaderboard.
+// Must be called on the game's goroutine.
+func (s *Server) updateRatings(game *Game, now time.Time) {
+	for _, leaderboard := range []string{game.Mode, database.GlobalLeaderboard} {
+		changes, err := s.ratingChanges(leaderboard, game, now)
+		if err != nil {
+			game.logger.Error("Error rating game", "leaderboard", leaderboard, "error", err)
+			continue
+		}
+		if err := s.db.UpdateRatings(leaderboard, changes, now); err != nil {
+			game.logger.Error("Error rating game", "leaderboard", leaderboard, "error", err)
+		}
+	}
+}
+
+// ratingChanges computes the Elo change of every human in the game. Each side's average rating
+// is played against the average rating of the other sides, scoring 1 for every side it beat and
+// half for every side it tied with. Leavers lose against everyone. Bots are rated at the default
+// rating and never change. Must be called on the game's goroutine.
+func (s *Server) ratingChanges(leaderboard string, game *Game, now time.Time) (map[string]int, error) {
+	ids := []string{}
+	for _, player := range append(append([]*Player(nil), game.Players...), game.Leavers...) {
+		if !player.IsBot {
+			ids = append(ids, player.ID)
+		}
+	}
+	ratings, err := s.db.GetRatings(leaderboard, ids)
+	if err != nil {
+		return nil, err
+	}
+	ratingOf := func(player *Player) float64 {
+		if rating, ok := ratings[player.ID]; ok {
+			return float64(rating)
+		}
+		return database.DefaultRating
+	}
+	sides := playerSides(game)
+	// averageRating of the players in the game on (or not on) the side
+	averageRating := func(side int, on bool) float64 {
+		total, count := 0.0, 0
+		for _, player := range game.Players {
+			if (sides[player] == side) == on {
+				total += ratingOf(player)
+				count++
+			}
+		}
+		if count == 0 {
+			return database.DefaultRating
+		}
+		return total / float64(count)
+	}
+
+	changes := make(map[string]int)
+	standings := gameStandings(game, sides, now)
+	if len(standings) > 1 {
+		for _, player := range game.Players {
+			if player.IsBot {
+				continue
+			}
+			side := sides[player]
+			standing := standings[side]
+			actual := (float64(standing.Beaten) + float64(standing.Tied)/2) / float64(len(standings)-1)
+			changes[player.ID] = eloChange(averageRating(side, true), averageRating(side, false), actual)
+		}
+	}
+	for _, leaver := range game.Leavers {
+		side, ok := sides[leaver]
+		if !ok || leaver.IsBot {
+			continue
+		}
+		if _, rated := changes[leaver.ID]; rated {
+			continue
+		}
+		changes[leaver.ID] = eloChange(ratingOf(leaver), averageRating(side, false), 0)
+	}
+	return changes, nil
+}
+
+func eloChange(rating, opponentRating, actual float64) int {
+	expected := 1 / (1 + math.Pow(10, (opponentRating-rating)/400))
+	return int(math.Round(float64(ratingK) * (actual - expected)))
+}
+
+// leaderboardParam reads the leaderboard named by the mode query parameter, the global one by default.
+func leaderboardParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	leaderboard := r.URL.Query().Get("mode")
+	if leaderboard == "" {
+		return database.GlobalLeaderboard, true
+	}
+	if _, ok := gameModes[leaderboard]; !ok && leaderboard != database.GlobalLeaderboard {
+		http.Error(w, "Unknown mode", http.StatusNotFound)
+		return "", false
+	}
+	return leaderboard, true
+}
+
+// queryInt reads a non-negative integer query parameter, writing the error response if invalid.
+func queryInt(w http.ResponseWriter, r *http.Request, name string, def, max int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		http.Error(w, "Invalid "+name, http.StatusBadRequest)
+		return 0, false
+	}
+	return min(n, max), true
+}
+
+// pageParams reads the offset and limit query parameters.
+func pageParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	offset, ok := queryInt(w, r, "offset", 0, math.MaxInt32)
+	if !ok {
+		return 0, 0, false
+	}
+	limit, ok := queryInt(w, r, "limit", defaultLeaderboardLimit, maxLeaderboardLimit)
+	return offset, limit, ok
+}
+
+func (s *Server) GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	leaderboard, ok := leaderboardParam(w, r)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	season, err := s.db.CurrentSeason()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, total, err := s.db.GetLeaderboard(leaderboard, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"leaderboard": leaderboard,
+		"season":      season,
+		"total":       total,
+		"offset":      offset,
+		"entries":     entries,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// GetPlayerRankHandler returns the player's rank with the players just above and below them.
+func (s *Server) GetPlayerRankHandler(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+	leaderboard, ok := leaderboardParam(w, r)
+	if !ok {
+		return
+	}
+	neighbours, ok := queryInt(w, r, "neighbours", defaultNeighbours, maxNeighbours)
+	if !ok {
+		return
+	}
+	position, err := s.db.GetLeaderboardPosition(leaderboard, playerId)
+	if errors.Is(err, database.ErrPlayerNotRanked) {
+		http.Error(w, "Player is not ranked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	offset := max(0, position-neighbours)
+	entries, total, err := s.db.GetLeaderboard(leaderboard, offset, position-offset+neighbours+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"leaderboard": leaderboard,
+		"playerId":    playerId,
+		"rank":        position + 1,
+		"total":       total,
+		"entries":     entries,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+func (s *Server) GetSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	seasons, err := s.db.GetSeasons()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, seasons, http.StatusOK)
+}
+
+// GetSeasonStandingsHandler returns a page of the archived final standings of an ended season.
+func (s *Server) GetSeasonStandingsHandler(w http.ResponseWriter, r *http.Request) {
+	seasonId, err := strconv.ParseInt(mux.Vars(r)["seasonId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid seasonId", http.StatusBadRequest)
+		return
+	}
+	leaderboard, ok := leaderboardParam(w, r)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	season, err := s.db.GetSeason(seasonId)
+	if errors.Is(err, database.ErrSeasonNotFound) {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, total, err := s.db.GetSeasonStandings(seasonId, leaderboard, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"leaderboard": leaderboard,
+		"season":      season,
+		"total":       total,
+		"offset":      offset,
+		"entries":     entries,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// EndSeasonHandler archives the current season's standings, soft resets ratings and starts the
+// next season, named by the optional name in the body.
+func (s *Server) EndSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	season, err := s.db.EndSeason(req.Name, seasonResetFactor, s.clock.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Season ended", "new_season", season.Name)
+	response := map[string]interface{}{
+		"message": "Season ended",
+		"season":  season,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+	"game-server/internal/database"
+	"time"
+)
+
+// Abandons within this window make up a player's leaver score
+var leaverWindow = envDuration("LEAVER_WINDOW", 7*24*time.Hour)
+
+// Queue cooldown by leaver score, scores past the end get the last cooldown
+var leaverCooldowns = []time.Duration{0, 0, 5 * time.Minute, 15 * time.Minute, time.Hour, 24 * time.Hour}
+
+func leaverCooldown(score int) time.Duration {
+	if score >= len(leaverCooldowns) {
+		return leaverCooldowns[len(leaverCooldowns)-1]
+	}
+	return leaverCooldowns[score]
+}
+
+// recordAbandon marks the player as having abandoned the game and puts them on a matchmaking
+// cooldown that grows with the number of games they abandoned within the leaver window.
+func (s *Server) recordAbandon(game *Game, player *Player, now time.Time) {
+	if player.IsBot {
+		return
+	}
+	if err := s.db.MarkParticipantAbandoned(game.ID, player.ID, now); err != nil {
+		game.playerLogger(player).Error("Error recording abandon", "error", err)
+		return
+	}
+	score, err := s.db.CountAbandons(player.ID, now.Add(-leaverWindow))
+	if err != nil {
+		game.playerLogger(player).Error("Error counting abandons", "error", err)
+		return
+	}
+	cooldown := leaverCooldown(score)
+	game.playerLogger(player).Info("Player abandoned game", "leaver_score", score)
+	if cooldown == 0 {
+		return
+	}
+
+	expiresAt := now.Add(cooldown)
+	sanction := database.Sanction{
+		PlayerID:  player.ID,
+		Type:      database.SanctionMatchmakingCooldown,
+		Reason:    fmt.Sprintf("Left %d games recently", score),
+		IssuedBy:  "leaver-penalty",
+		ExpiresAt: &expiresAt,
+	}
+	if _, err := s.applySanction(sanction); err != nil {
+		game.playerLogger(player).Error("Error applying leaver cooldown", "error", err)
+	}
+}
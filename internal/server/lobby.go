@@ -0,0 +1,221 @@
+package server
+
+import (
+	"encoding/json"
+	"game-server/internal/database"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Notification and command types on the lobby socket
+const (
+	lobbyFriendRequest  = "friend_request"
+	lobbyFriendAccepted = "friend_accepted"
+	lobbyPartyInvite    = "party_invite"
+	lobbyGameInvite     = "game_invite"
+	lobbyInviteDeclined = "invite_declined"
+	lobbyPartyUpdate    = "party_update"
+	lobbyRoomJoined     = "room_joined"
+	lobbySystem         = "system"
+	lobbyError          = "error"
+
+	lobbyInviteParty   = "invite_party"
+	lobbyInviteGame    = "invite_game"
+	lobbyAcceptInvite  = "accept_invite"
+	lobbyDeclineInvite = "decline_invite"
+	lobbyLeaveParty    = "leave_party"
+	lobbyStartRoom     = "start_room"
+)
+
+// LobbyClient is a player's long-lived lobby connection, which lives independently of the
+// per-match socket and carries notifications and invites.
+type LobbyClient struct {
+	ID   string
+	Name string
+	Conn Conn
+	// Session chat sent from the lobby goes through, holding the player's chat rate limit, mutes
+	// and party like a match session does
+	chat *Player
+	// Logger carrying the player's ID
+	logger *slog.Logger
+}
+
+// lobbyCommand is a request a player sends over the lobby socket.
+type lobbyCommand struct {
+	Type     string `json:"type"`
+	To       string `json:"to"`
+	Mode     string `json:"mode"`
+	InviteID string `json:"inviteId"`
+}
+
+func (s *Server) LobbyConnect(w http.ResponseWriter, r *http.Request) {
+	userId := r.URL.Query().Get("ID")
+	name := r.URL.Query().Get("Name")
+	if userId == "" {
+		http.Error(w, "Missing userId", http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+	logger := requestLogger(r).With("player_id", userId)
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("Error upgrading connection", "error", err)
+		return
+	}
+	if sanction := s.activeSanction(userId, database.SanctionBan, database.SanctionSuspension); sanction != nil {
+		rejectSanctioned(logger, ws, sanction)
+		return
+	}
+	client := &LobbyClient{ID: userId, Name: name, Conn: s.newConn(ws), logger: logger}
+	client.chat = &Player{
+		ID:           userId,
+		Name:         name,
+		Conn:         client.Conn,
+		PartyID:      s.partyOf(userId),
+		mutedPlayers: s.loadMutes(userId),
+		logger:       logger,
+	}
+
+	s.mutex.Lock()
+	previous := s.lobbyClients[userId]
+	s.lobbyClients[userId] = client
+	invites := s.pendingInvites(userId)
+	s.mutex.Unlock()
+	if previous != nil {
+		previous.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Connected from another session"))
+		previous.Conn.Close()
+	}
+	logger.Info("Player connected to the lobby")
+
+	s.notify(userId, map[string]interface{}{
+		"type":    lobbySystem,
+		"message": "Connected to lobby",
+		"invites": invites,
+	})
+	s.notifyPresence(userId)
+
+	go func() {
+		s.readLobbyCommands(client)
+		s.mutex.Lock()
+		if s.lobbyClients[client.ID] == client {
+			delete(s.lobbyClients, client.ID)
+			s.closeHostedRooms(client.ID)
+		}
+		s.mutex.Unlock()
+		s.notifyPresence(client.ID)
+	}()
+}
+
+func (s *Server) readLobbyCommands(client *LobbyClient) {
+	for {
+		_, message, err := client.Conn.ReadMessage()
+		if err != nil {
+			client.logger.Debug("Stopped reading lobby client", "error", err)
+			return
+		}
+		var cmd lobbyCommand
+		if err := json.Unmarshal(message, &cmd); err != nil {
+			s.notifyError(client.ID, "Malformed lobby message")
+			continue
+		}
+		switch cmd.Type {
+		case messageTypeChat:
+			s.handleChat(client.chat, message)
+		case lobbyInviteParty:
+			s.inviteToParty(client, cmd.To)
+		case lobbyInviteGame:
+			s.inviteToGame(client, cmd.To, cmd.Mode)
+		case lobbyAcceptInvite:
+			s.acceptInvite(client, cmd.InviteID)
+		case lobbyDeclineInvite:
+			s.declineInvite(client, cmd.InviteID)
+		case lobbyLeaveParty:
+			s.leaveParty(client.ID)
+		case lobbyStartRoom:
+			s.startRoom(client)
+		default:
+			s.notifyError(client.ID, "Unknown lobby message type")
+		}
+	}
+}
+
+// kickLobbyClient closes the player's lobby connection, if they have one, with the reason.
+func (s *Server) kickLobbyClient(playerId string, reason string) {
+	s.mutex.Lock()
+	client := s.lobbyClients[playerId]
+	s.mutex.Unlock()
+	if client == nil {
+		return
+	}
+	client.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+	client.Conn.Close()
+}
+
+// notify sends a notification to the player's lobby connection, if they have one.
+func (s *Server) notify(playerId string, notification interface{}) bool {
+	s.mutex.Lock()
+	client := s.lobbyClients[playerId]
+	s.mutex.Unlock()
+	if client == nil {
+		return false
+	}
+	if err := client.Conn.WriteJSON(notification); err != nil {
+		client.logger.Warn("Error sending lobby notification", "error", err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) notifyError(playerId string, message string) {
+	s.notify(playerId, map[string]string{
+		"type":    lobbyError,
+		"message": message,
+	})
+}
+
+// SystemNotificationHandler sends a system notification to one player's lobby, or to every
+// connected lobby when no playerId is given.
+func (s *Server) SystemNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PlayerID string `json:"playerId"`
+		Message  string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Message == "" {
+		http.Error(w, "Missing message", http.StatusBadRequest)
+		return
+	}
+	notification := map[string]string{
+		"type":    lobbySystem,
+		"message": req.Message,
+	}
+
+	recipients := []string{req.PlayerID}
+	if req.PlayerID == "" {
+		recipients = []string{}
+		s.mutex.Lock()
+		for id := range s.lobbyClients {
+			recipients = append(recipients, id)
+		}
+		s.mutex.Unlock()
+	}
+	delivered := 0
+	for _, id := range recipients {
+		if s.notify(id, notification) {
+			delivered++
+		}
+	}
+	response := map[string]interface{}{
+		"message":   "Notification sent",
+		"delivered": delivered,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Logs are structured, configured with LOG_LEVEL (debug, info, warn or error, default info) and
+// LOG_FORMAT (json, the default, or text). Lines about a game carry its game_id and mode, lines
+// about a player their player_id and mode, and lines logged while handling a request its
+// request_id.
+var (
+	logLevel  = envLogLevel("LOG_LEVEL", slog.LevelInfo)
+	logFormat = os.Getenv("LOG_FORMAT")
+)
+
+// envLogLevel reads a log level from the environment, falling back to def when unset or invalid.
+func envLogLevel(name string, def slog.Level) slog.Level {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return level
+}
+
+// NewLogger returns a logger writing to w in the configured format and level.
+func NewLogger(w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{Level: logLevel}
+	if logFormat == "text" {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+type loggerKey struct{}
+
+// withRequestID gives every request an ID, taken from its X-Request-ID header or generated, and
+// echoes it in the response. Handlers log through requestLogger to have their lines carry it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		logger := slog.With("request_id", id)
+		start := time.Now()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger)))
+		logger.Debug("Handled request", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	})
+}
+
+// requestLogger returns the logger of the request, which carries its request ID.
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// playerLogger returns the logger for lines about the player in the game, or the player's own
+// logger when the game is nil.
+func (g *Game) playerLogger(player *Player) *slog.Logger {
+	if g == nil {
+		return player.logger
+	}
+	return g.logger.With("player_id", player.ID)
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Histogram buckets, in seconds
+var (
+	queueWaitBuckets = []float64{1, 2, 5, 10, 20, 30, 60, 120, 300}
+	tickBuckets      = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.016, 0.025, 0.05, 0.1}
+	dbQueryBuckets   = []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}
+)
+
+// Metrics collects the counters and histograms served on /metrics. Gauges such as connection
+// counts and active games are read from the server when scraped.
+type Metrics struct {
+	messagesIn   atomic.Int64
+	messagesOut  atomic.Int64
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	writeErrors  atomic.Int64
+	tickOverruns atomic.Int64
+	// Open replay sockets, the other connections are counted from the server's registries
+	replayViewers atomic.Int64
+
+	queueWait    *histogram
+	tickDuration *histogram
+	dbQuery      *histogram
+
+	mu         sync.Mutex
+	queueDepth map[string]int
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		queueWait:    newHistogram(queueWaitBuckets),
+		tickDuration: newHistogram(tickBuckets),
+		dbQuery:      newHistogram(dbQueryBuckets),
+		queueDepth:   make(map[string]int),
+	}
+}
+
+// histogram counts observations into cumulative buckets, per label value.
+type histogram struct {
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+func (h *histogram) observe(label string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[label]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[label] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// observeQueueWait records how long a human player waited in the queue of the mode before a game took them.
+func (m *Metrics) observeQueueWait(player *Player, now time.Time) {
+	if player.IsBot || player.QueuedAt.IsZero() {
+		return
+	}
+	m.queueWait.observe(player.Mode, now.Sub(player.QueuedAt).Seconds())
+}
+
+// observeTick records a game tick that started at start, counting it as an overrun when it took
+// longer than the tick interval.
+func (m *Metrics) observeTick(start time.Time) {
+	d := time.Since(start)
+	m.tickDuration.observe("", d.Seconds())
+	if d > tickInterval {
+		m.tickOverruns.Add(1)
+	}
+}
+
+// observeQuery is the database's query observer.
+func (m *Metrics) observeQuery(statement string, d time.Duration) {
+	m.dbQuery.observe(statement, d.Seconds())
+}
+
+// setQueueDepths records how many players wait in each mode's queue, private rooms included.
+func (m *Metrics) setQueueDepths(waiting map[string][]*Player) {
+	depth := make(map[string]int)
+	for name := range gameModes {
+		depth[name] = 0
+	}
+	for _, queued := range waiting {
+		for _, player := range queued {
+			depth[player.Mode]++
+		}
+	}
+	m.mu.Lock()
+	m.queueDepth = depth
+	m.mu.Unlock()
+}
+
+// received and sent count a message on a socket.
+func (m *Metrics) received(n int) {
+	m.messagesIn.Add(1)
+	m.bytesIn.Add(int64(n))
+}
+
+func (m *Metrics) sent(n int, err error) {
+	if err != nil {
+		m.writeErrors.Add(1)
+		return
+	}
+	m.messagesOut.Add(1)
+	m.bytesOut.Add(int64(n))
+}
+
+// MetricsHandler serves the server's metrics in the Prometheus text exposition format.
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	m := s.metrics
+
+	s.mutex.Lock()
+	players, lobby := len(s.clients), len(s.lobbyClients)
+	s.mutex.Unlock()
+	activeGames := make(map[string]int)
+	for name := range gameModes {
+		activeGames[name] = 0
+	}
+	spectators := 0
+	s.mu.Lock()
+	for _, game := range s.activeGames {
+		activeGames[game.Mode]++
+		spectators += game.Spectators.count()
+	}
+	s.mu.Unlock()
+
+	writeHeader(out, "game_server_connections", "gauge", "Open WebSocket connections by type.")
+	writeSample(out, "game_server_connections", "type", "player", float64(players))
+	writeSample(out, "game_server_connections", "type", "lobby", float64(lobby))
+	writeSample(out, "game_server_connections", "type", "spectator", float64(spectators))
+	writeSample(out, "game_server_connections", "type", "replay", float64(m.replayViewers.Load()))
+
+	m.mu.Lock()
+	queueDepth := m.queueDepth
+	m.mu.Unlock()
+	writeHeader(out, "game_server_queue_depth", "gauge", "Players waiting for a match by mode.")
+	for _, mode := range sortedKeys(queueDepth) {
+		writeSample(out, "game_server_queue_depth", "mode", mode, float64(queueDepth[mode]))
+	}
+	writeHistogram(out, "game_server_queue_wait_seconds", "Time players waited in the queue before joining a game, by mode.", "mode", m.queueWait)
+
+	writeHeader(out, "game_server_active_games", "gauge", "Running games by mode.")
+	for _, mode := range sortedKeys(activeGames) {
+		writeSample(out, "game_server_active_games", "mode", mode, float64(activeGames[mode]))
+	}
+
+	writeHistogram(out, "game_server_tick_duration_seconds", "Time a game tick took, including its state broadcast.", "", m.tickDuration)
+	writeHeader(out, "game_server_tick_overruns_total", "counter", "Game ticks that took longer than the tick interval.")
+	writeSample(out, "game_server_tick_overruns_total", "", "", float64(m.tickOverruns.Load()))
+	if len(s.shards) > 0 {
+		writeHeader(out, "game_server_worker_tick_seconds", "gauge", "Average time a game worker's batch of ticks takes.")
+		for _, shard := range s.shards {
+			stats := shard.snapshot()
+			writeSample(out, "game_server_worker_tick_seconds", "worker", strconv.Itoa(stats.ID), stats.AverageTick.Seconds())
+		}
+	}
+
+	writeHeader(out, "game_server_messages_total", "counter", "WebSocket messages received and sent.")
+	writeSample(out, "game_server_messages_total", "direction", "in", float64(m.messagesIn.Load()))
+	writeSample(out, "game_server_messages_total", "direction", "out", float64(m.messagesOut.Load()))
+	writeHeader(out, "game_server_bytes_total", "counter", "WebSocket message bytes received and sent.")
+	writeSample(out, "game_server_bytes_total", "direction", "in", float64(m.bytesIn.Load()))
+	writeSample(out, "game_server_bytes_total", "direction", "out", float64(m.bytesOut.Load()))
+	writeHeader(out, "game_server_write_errors_total", "counter", "WebSocket writes that failed.")
+	writeSample(out, "game_server_write_errors_total", "", "", float64(m.writeErrors.Load()))
+
+	writeHistogram(out, "game_server_db_query_duration_seconds", "Time database queries took, by statement.", "statement", m.dbQuery)
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a sample with at most one label, none when labelName is empty.
+func writeSample(w io.Writer, name, labelName, labelValue string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels(labelName, labelValue, ""), formatFloat(value))
+}
+
+func writeHistogram(w io.Writer, name, help, labelName string, h *histogram) {
+	writeHeader(w, name, "histogram", help)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, label := range sortedKeys(h.series) {
+		series := h.series[label]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(labelName, label, formatFloat(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(labelName, label, "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels(labelName, label, ""), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels(labelName, label, ""), series.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats the label set of a sample, with the histogram bucket bound le when given.
+func labels(name, value, le string) string {
+	pairs := []string{}
+	if name != "" {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(value)+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
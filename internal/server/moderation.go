@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"game-server/internal/database"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Message types for muting players and reporting them
+const (
+	messageTypeMute   = "mute"
+	messageTypeUnmute = "unmute"
+	messageTypeReport = "report"
+)
+
+// ChatModerator inspects a chat message before it is delivered. It may rewrite the message text,
+// or reject the message by returning the reason shown to the sender.
+type ChatModerator interface {
+	Moderate(sender *Player, msg *ChatMessage) (rejectReason string)
+}
+
+// Moderators every chat message passes through, in order
+var chatModerators = []ChatModerator{loadWordFilter()}
+
+// Words masked when CHAT_FILTER_FILE isn't set
+var defaultFilteredWords = []string{"fuck", "shit", "bitch", "asshole", "cunt"}
+
+// wordFilter masks filtered words and patterns with asterisks.
+type wordFilter struct {
+	pattern *regexp.Regexp
+}
+
+// loadWordFilter builds the word filter from CHAT_FILTER_FILE, which lists one word per line.
+// Lines starting with "re:" are regular expressions, lines starting with "#" are comments.
+func loadWordFilter() *wordFilter {
+	path := os.Getenv("CHAT_FILTER_FILE")
+	if path == "" {
+		return newWordFilter(defaultFilteredWords, nil)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Error("Error opening chat filter file", "path", path, "error", err)
+		return newWordFilter(defaultFilteredWords, nil)
+	}
+	defer file.Close()
+
+	words, patterns := []string{}, []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "re:"):
+			patterns = append(patterns, strings.TrimPrefix(line, "re:"))
+		default:
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Error("Error reading chat filter file", "path", path, "error", err)
+	}
+	return newWordFilter(words, patterns)
+}
+
+func newWordFilter(words, patterns []string) *wordFilter {
+	alternatives := []string{}
+	for _, word := range words {
+		alternatives = append(alternatives, `\b`+regexp.QuoteMeta(word)+`\b`)
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			slog.Warn("Skipping invalid chat filter pattern", "pattern", pattern, "error", err)
+			continue
+		}
+		alternatives = append(alternatives, "(?:"+pattern+")")
+	}
+	if len(alternatives) == 0 {
+		return &wordFilter{}
+	}
+	return &wordFilter{pattern: regexp.MustCompile("(?i)" + strings.Join(alternatives, "|"))}
+}
+
+func (f *wordFilter) Moderate(sender *Player, msg *ChatMessage) string {
+	if f.pattern == nil {
+		return ""
+	}
+	msg.Text = f.pattern.ReplaceAllStringFunc(msg.Text, func(match string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(match))
+	})
+	return ""
+}
+
+// moderateChat runs the message through the moderation pipeline.
+func moderateChat(sender *Player, msg *ChatMessage) string {
+	for _, moderator := range chatModerators {
+		if reason := moderator.Moderate(sender, msg); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// loadMutes returns the set of players the player muted.
+func (s *Server) loadMutes(playerId string) map[string]bool {
+	muted := make(map[string]bool)
+	ids, err := s.db.GetPlayerMutes(playerId)
+	if err != nil {
+		slog.Error("Error getting mutes", "player_id", playerId, "error", err)
+		return muted
+	}
+	for _, id := range ids {
+		muted[id] = true
+	}
+	return muted
+}
+
+// handleMute mutes or unmutes another player for the sender.
+func (s *Server) handleMute(player *Player, messageType string, data []byte) {
+	var msg struct {
+		PlayerID string `json:"playerId"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.PlayerID == "" {
+		sendChatError(player, "Missing playerId")
+		return
+	}
+
+	var err error
+	if messageType == messageTypeMute {
+		err = s.db.StorePlayerMute(player.ID, msg.PlayerID, s.clock.Now())
+	} else {
+		err = s.db.DeletePlayerMute(player.ID, msg.PlayerID)
+	}
+	if err != nil {
+		player.logger.Error("Error updating mutes", "error", err)
+		sendChatError(player, "Could not update mutes")
+		return
+	}
+
+	s.mu.Lock()
+	if messageType == messageTypeMute {
+		player.mutedPlayers[msg.PlayerID] = true
+	} else {
+		delete(player.mutedPlayers, msg.PlayerID)
+	}
+	s.mu.Unlock()
+}
+
+// handleReport stores a report against another player along with the chat the reporter saw.
+func (s *Server) handleReport(player *Player, data []byte) {
+	var msg struct {
+		PlayerID string `json:"playerId"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.PlayerID == "" {
+		sendChatError(player, "Missing playerId")
+		return
+	}
+	if msg.Reason == "" {
+		sendChatError(player, "Missing reason")
+		return
+	}
+
+	s.mu.Lock()
+	context, err := json.Marshal(player.recentChat)
+	gameId := player.GameID
+	s.mu.Unlock()
+	if err != nil {
+		player.logger.Error("Error encoding chat context", "game_id", gameId, "error", err)
+		return
+	}
+	report := database.Report{
+		ReporterID:  player.ID,
+		ReportedID:  msg.PlayerID,
+		GameID:      gameId,
+		Reason:      msg.Reason,
+		ChatContext: string(context),
+		CreatedAt:   s.clock.Now(),
+	}
+	if _, err := s.db.StoreReport(report); err != nil {
+		player.logger.Error("Error storing report", "game_id", gameId, "error", err)
+		sendChatError(player, "Could not store report")
+		return
+	}
+	player.logger.Info("Player reported a player", "game_id", gameId, "reported_id", msg.PlayerID)
+}
+
+func (s *Server) GetReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = database.ReportOpen
+	}
+	reports, err := s.db.GetReports(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, reports, http.StatusOK)
+}
+
+func (s *Server) ReviewReportHandler(w http.ResponseWriter, r *http.Request) {
+	reportId, err := strconv.ParseInt(mux.Vars(r)["reportId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reportId", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		ReviewedBy string `json:"reviewedBy"`
+		Resolution string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ReviewedBy == "" {
+		http.Error(w, "Missing reviewedBy", http.StatusBadRequest)
+		return
+	}
+	err = s.db.ReviewReport(reportId, req.ReviewedBy, req.Resolution, s.clock.Now())
+	if errors.Is(err, database.ErrReportNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"message":  "Report reviewed successfully",
+		"reportId": reportId,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"game-server/internal/database"
+	"time"
+)
+
+const defaultMode = "default"
+
+// Time between two game ticks
+const tickInterval = 16 * time.Millisecond
+
+// Time a disconnected player keeps their slot before it is opened up for backfill
+const disconnectGracePeriod = 15 * time.Second
+
+type GameMode struct {
+	Name      string `json:"name"`
+	MatchSize int    `json:"matchSize"`
+	// Players are split evenly into this many teams
+	Teams int `json:"teams"`
+	// Backfill lets the matchmaker place queued players into running games with open slots
+	Backfill bool `json:"backfill"`
+	// How long the oldest queued player waits before the match is filled with bots, 0 disables bot fill
+	BotFillTimeout time.Duration `json:"botFillTimeout"`
+	// ReplaceLeavers fills open slots in running games with bots when no queued player can take them
+	ReplaceLeavers bool `json:"replaceLeavers"`
+	// The game is won by the first side to reach this score, 0 disables the limit
+	ScoreLimit int `json:"scoreLimit"`
+	// Games still running after this long end in a timeout, 0 disables the limit
+	TimeLimit time.Duration `json:"timeLimit"`
+	// How far behind the game spectators are kept so they can't relay it to players
+	SpectatorDelay time.Duration `json:"spectatorDelay"`
+}
+
+var gameModes = map[string]*GameMode{
+	defaultMode: {
+		Name:           defaultMode,
+		MatchSize:      6,
+		Teams:          2,
+		Backfill:       true,
+		BotFillTimeout: envDuration("BOT_FILL_TIMEOUT", 30*time.Second),
+		ReplaceLeavers: true,
+		ScoreLimit:     50,
+		TimeLimit:      10 * time.Minute,
+		SpectatorDelay: envDuration("SPECTATOR_DELAY", 0),
+	},
+	"ranked": {
+		Name:           "ranked",
+		MatchSize:      6,
+		Teams:          2,
+		Backfill:       false,
+		BotFillTimeout: envDuration("RANKED_BOT_FILL_TIMEOUT", 0),
+		ScoreLimit:     75,
+		TimeLimit:      15 * time.Minute,
+		SpectatorDelay: envDuration("RANKED_SPECTATOR_DELAY", 30*time.Second),
+	},
+}
+
+// gone reports whether the player has been disconnected for longer than the grace period.
+func (p *Player) gone(now time.Time) bool {
+	return p.Disconnected && now.Sub(p.DisconnectedAt) > disconnectGracePeriod
+}
+
+// endCondition returns why the game should end now, or "" while it goes on. Games end when every
+// human is gone, when a single side is left standing, when a side reaches the mode's score limit
+// or when the mode's time limit runs out. Must be called on the game's goroutine.
+func endCondition(game *Game, now time.Time) string {
+	mode := gameModes[game.Mode]
+	humans := false
+	for _, player := range game.Players {
+		if !player.IsBot && !player.gone(now) {
+			humans = true
+			break
+		}
+	}
+	if !humans {
+		return database.EndAbandoned
+	}
+
+	sides := playerSides(game)
+	scores := make(map[int]int)
+	for player, side := range sides {
+		scores[side] += player.Score
+	}
+	if len(scores) > 1 && len(standingSides(game, sides, now)) == 1 {
+		return database.EndForfeit
+	}
+	if mode.ScoreLimit > 0 {
+		for _, score := range scores {
+			if score >= mode.ScoreLimit {
+				return database.EndCompleted
+			}
+		}
+	}
+	if mode.TimeLimit > 0 && game.simTime().Sub(game.StartedAt) >= mode.TimeLimit {
+		return database.EndTimeout
+	}
+	return ""
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"game-server/internal/database"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Messages on the replay socket
+const (
+	messageTypeReplay      = "replay"
+	messageTypeReplayEnd   = "replay_end"
+	messageTypeReplayError = "replay_error"
+
+	replayPause  = "pause"
+	replayResume = "resume"
+	replaySeek   = "seek"
+	replaySpeed  = "speed"
+)
+
+const maxReplaySpeed = 16
+
+// replayControl is a playback command sent by the viewer.
+type replayControl struct {
+	Type  string  `json:"type"`
+	Tick  int64   `json:"tick"`
+	Speed float64 `json:"speed"`
+}
+
+// readReplay decodes a stored replay into its header and keyframes, ordered by tick.
+func readReplay(data []byte) (*replayHeader, []replayEntry, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+	dec := json.NewDecoder(gz)
+
+	var header replayHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, nil, err
+	}
+	keyframes := []replayEntry{}
+	for {
+		var entry replayEntry
+		err := dec.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry.Type == replayKeyframe {
+			keyframes = append(keyframes, entry)
+		}
+	}
+	sort.SliceStable(keyframes, func(i, j int) bool { return keyframes[i].Tick < keyframes[j].Tick })
+	return &header, keyframes, nil
+}
+
+// ReplayConnect streams the keyframes of a recorded game in the format of live state updates, at
+// the pace they were recorded. Viewers can pause, resume, seek to a tick and change the speed.
+func (s *Server) ReplayConnect(w http.ResponseWriter, r *http.Request) {
+	gameId := mux.Vars(r)["gameId"]
+	data, err := s.db.GetReplay(gameId)
+	if errors.Is(err, database.ErrReplayNotFound) {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger := requestLogger(r).With("game_id", gameId)
+	header, keyframes, err := readReplay(data)
+	if err != nil {
+		logger.Error("Error reading replay", "error", err)
+		http.Error(w, "Replay is corrupt", http.StatusInternalServerError)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("Error upgrading connection", "error", err)
+		return
+	}
+	conn := s.newConn(ws)
+	defer conn.Close()
+	s.metrics.replayViewers.Add(1)
+	defer s.metrics.replayViewers.Add(-1)
+	// Closed when playback stops so the reader doesn't block on a control no one receives
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	lastTick := int64(0)
+	if len(keyframes) > 0 {
+		lastTick = keyframes[len(keyframes)-1].Tick
+	}
+	err = conn.WriteJSON(map[string]interface{}{
+		"type":     messageTypeReplay,
+		"header":   header,
+		"lastTick": lastTick,
+	})
+	if err != nil {
+		return
+	}
+
+	controls := make(chan replayControl)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var control replayControl
+			if err := json.Unmarshal(message, &control); err != nil {
+				conn.WriteJSON(map[string]string{"type": messageTypeReplayError, "message": "Malformed replay control"})
+				continue
+			}
+			select {
+			case controls <- control:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	playReplay(s.clock, conn, header, keyframes, controls, done)
+}
+
+// playReplay sends the keyframes one by one, waiting the recorded number of ticks between them
+// divided by the speed, until the viewer disconnects. Playback stops at the end until the viewer
+// seeks back.
+func playReplay(clock Clock, conn Conn, header *replayHeader, keyframes []replayEntry, controls <-chan replayControl, done <-chan struct{}) {
+	tick := time.Duration(header.TickIntervalMs) * time.Millisecond
+	speed := 1.0
+	paused := false
+	next := 0
+	// Fires when the next keyframe is due, nil while paused or at the end
+	due := clock.After(0)
+
+	for {
+		select {
+		case <-done:
+			return
+		case control := <-controls:
+			switch control.Type {
+			case replayPause:
+				paused = true
+				due = nil
+			case replayResume:
+				paused = false
+				due = clock.After(0)
+			case replaySeek:
+				next = sort.Search(len(keyframes), func(i int) bool { return keyframes[i].Tick >= control.Tick })
+				if !paused {
+					due = clock.After(0)
+				}
+			case replaySpeed:
+				if control.Speed <= 0 || control.Speed > maxReplaySpeed {
+					conn.WriteJSON(map[string]string{"type": messageTypeReplayError, "message": "Invalid speed"})
+					continue
+				}
+				speed = control.Speed
+			default:
+				conn.WriteJSON(map[string]string{"type": messageTypeReplayError, "message": "Unknown replay control"})
+			}
+		case <-due:
+			due = nil
+			if next >= len(keyframes) {
+				// Stay connected so the viewer can seek back
+				if err := conn.WriteJSON(map[string]interface{}{"type": messageTypeReplayEnd}); err != nil {
+					return
+				}
+				continue
+			}
+			if err := conn.WriteJSON(keyframes[next].State); err != nil {
+				return
+			}
+			next++
+			if next < len(keyframes) {
+				ticks := keyframes[next].Tick - keyframes[next-1].Tick
+				due = clock.After(time.Duration(float64(time.Duration(ticks)*tick) / speed))
+			} else {
+				due = clock.After(0)
+			}
+		}
+	}
+}
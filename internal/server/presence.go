@@ -0,0 +1,76 @@
+package server
+
+import "log/slog"
+
+// Presence statuses
+const (
+	presenceOffline = "offline"
+	presenceOnline  = "online"
+	presenceInQueue = "in_queue"
+	presenceInGame  = "in_game"
+)
+
+const messageTypePresence = "presence"
+
+// presenceOf derives the player's presence from the connection registry and the active games.
+func (s *Server) presenceOf(playerId string) string {
+	player := s.connectedClient(playerId)
+	if player == nil {
+		s.mutex.Lock()
+		_, inLobby := s.lobbyClients[playerId]
+		s.mutex.Unlock()
+		if inLobby {
+			return presenceOnline
+		}
+		return presenceOffline
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.activeGames[player.GameID]; ok {
+		return presenceInGame
+	}
+	if !player.QueuedAt.IsZero() {
+		return presenceInQueue
+	}
+	return presenceOnline
+}
+
+// notifyPresence pushes the player's presence to their online friends when it changed since
+// the last push, over the friend's lobby connection or else their match socket.
+func (s *Server) notifyPresence(playerId string) {
+	status := s.presenceOf(playerId)
+	s.mutex.Lock()
+	changed := s.presence[playerId] != status
+	if status == presenceOffline {
+		delete(s.presence, playerId)
+	} else {
+		s.presence[playerId] = status
+	}
+	s.mutex.Unlock()
+	if !changed {
+		return
+	}
+
+	friendIds, err := s.db.GetFriendIDs(playerId)
+	if err != nil {
+		slog.Error("Error getting friends", "player_id", playerId, "error", err)
+		return
+	}
+	update := map[string]string{
+		"type":     messageTypePresence,
+		"playerId": playerId,
+		"status":   status,
+	}
+	for _, friendId := range friendIds {
+		if s.notify(friendId, update) {
+			continue
+		}
+		friend := s.connectedClient(friendId)
+		if friend == nil {
+			continue
+		}
+		if err := friend.Conn.WriteJSON(update); err != nil {
+			friend.logger.Warn("Error sending presence", "error", err)
+		}
+	}
+}
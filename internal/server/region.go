@@ -0,0 +1,178 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Latency (ms) a player always accepts for a region
+	baseAcceptableLatency = 80
+	// How much the acceptable latency (ms) grows for every second a player spends in the queue
+	latencyRelaxPerSecond = 5
+	// After this long in the queue a player is matched in any region
+	maxRegionWait = 60 * time.Second
+)
+
+// Regions game servers are deployed in, configured as a comma separated REGIONS list
+var regions = loadRegions()
+
+func loadRegions() []string {
+	regions := []string{}
+	for _, region := range strings.Split(os.Getenv("REGIONS"), ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	if len(regions) == 0 {
+		regions = append(regions, "default")
+	}
+	return regions
+}
+
+// parseLatencies parses the latencies a client measured to each region,
+// formatted as "region:ms,region:ms".
+func parseLatencies(value string) (map[string]int, error) {
+	latencies := make(map[string]int)
+	if value == "" {
+		return latencies, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		region, ms, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid latency entry %q", entry)
+		}
+		latency, err := strconv.Atoi(ms)
+		if err != nil || latency < 0 {
+			return nil, fmt.Errorf("invalid latency for region %q", region)
+		}
+		latencies[strings.TrimSpace(region)] = latency
+	}
+	return latencies, nil
+}
+
+// acceptableLatency returns the highest latency a player accepts after waiting in the queue.
+func acceptableLatency(waited time.Duration) int {
+	return baseAcceptableLatency + int(waited.Seconds())*latencyRelaxPerSecond
+}
+
+// acceptsRegion reports whether the player can be matched in the region. Players that did not
+// report latencies, such as bots, accept every region.
+func (p *Player) acceptsRegion(region string, now time.Time) bool {
+	if len(p.Latencies) == 0 {
+		return true
+	}
+	waited := now.Sub(p.QueuedAt)
+	if waited >= maxRegionWait {
+		return true
+	}
+	latency, ok := p.Latencies[region]
+	if !ok {
+		return false
+	}
+	return latency <= acceptableLatency(waited)
+}
+
+// regionLatency sums the latencies of the players to the region. Players without a measurement
+// for the region count as the worst acceptable latency.
+func regionLatency(players []*Player, region string) int {
+	total := 0
+	for _, player := range players {
+		if len(player.Latencies) == 0 {
+			continue
+		}
+		latency, ok := player.Latencies[region]
+		if !ok {
+			latency = acceptableLatency(maxRegionWait)
+		}
+		total += latency
+	}
+	return total
+}
+
+// bestRegion returns the region with the lowest total latency for the players.
+func bestRegion(players []*Player) string {
+	best, bestLatency := regions[0], math.MaxInt
+	for _, region := range regions {
+		if latency := regionLatency(players, region); latency < bestLatency {
+			best, bestLatency = region, latency
+		}
+	}
+	return best
+}
+
+// findRegionMatch picks the longest waiting players that all accept the same region. When several
+// regions can host a match the one with the lowest total latency wins.
+func findRegionMatch(mode *GameMode, queued []*Player, now time.Time) (string, []*Player) {
+	var bestPlayers []*Player
+	best, bestLatency := "", math.MaxInt
+	for _, region := range regions {
+		players := []*Player{}
+		for _, player := range queued {
+			if player.acceptsRegion(region, now) {
+				players = append(players, player)
+			}
+			if len(players) == mode.MatchSize {
+				break
+			}
+		}
+		if len(players) < mode.MatchSize {
+			continue
+		}
+		if latency := regionLatency(players, region); latency < bestLatency {
+			best, bestLatency, bestPlayers = region, latency, players
+		}
+	}
+	return best, bestPlayers
+}
+
+// botFillMatch picks the players of a match filled with bots once the oldest queued player has
+// waited the mode's BotFillTimeout: the longest waiting players that accept the region the oldest
+// player has the lowest latency to, among the regions they accept. It returns no players while
+// the oldest player accepts no region, so a match is never made of bots only.
+func botFillMatch(mode *GameMode, queued []*Player, now time.Time) (string, []*Player) {
+	if len(queued) == 0 || mode.BotFillTimeout <= 0 || now.Sub(queued[0].QueuedAt) <= mode.BotFillTimeout {
+		return "", nil
+	}
+	best, bestLatency := "", math.MaxInt
+	for _, region := range regions {
+		if !queued[0].acceptsRegion(region, now) {
+			continue
+		}
+		if latency := regionLatency(queued[:1], region); latency < bestLatency {
+			best, bestLatency = region, latency
+		}
+	}
+	if best == "" {
+		return "", nil
+	}
+	players := []*Player{}
+	for _, player := range queued {
+		if len(players) < mode.MatchSize && player.acceptsRegion(best, now) {
+			players = append(players, player)
+		}
+	}
+	return best, players
+}
+
+// removePlayers returns queued without the matched players, keeping queue order.
+func removePlayers(queued []*Player, matched []*Player) []*Player {
+	remaining := []*Player{}
+	for _, player := range queued {
+		isMatched := false
+		for _, m := range matched {
+			if m == player {
+				isMatched = true
+				break
+			}
+		}
+		if !isMatched {
+			remaining = append(remaining, player)
+		}
+	}
+	return remaining
+}
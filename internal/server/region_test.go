@@ -0,0 +1,21 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBotFillWaitsForAnAcceptedRegion(t *testing.T) {
+	mode := &GameMode{Name: "test", MatchSize: 4, Teams: 2, BotFillTimeout: time.Second}
+	// Too far from every region until the latency limit has relaxed far enough
+	player := &Player{ID: "far", QueuedAt: testEpoch, Latencies: map[string]int{regions[0]: 200}}
+	queued := []*Player{player}
+
+	if _, players := botFillMatch(mode, queued, testEpoch.Add(5*time.Second)); players != nil {
+		t.Fatalf("filled a match with bots around %d players who accept no region", len(players))
+	}
+	region, players := botFillMatch(mode, queued, testEpoch.Add(30*time.Second))
+	if len(players) != 1 || players[0] != player || region != regions[0] {
+		t.Fatalf("got a bot fill of %v in %q once the player accepts %q", players, region, regions[0])
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"game-server/internal/database"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Whether games record a replay of their inputs and state
+var recordReplays = envBool("RECORD_REPLAYS", true)
+
+// Ticks between two state keyframes in a replay
+var replayKeyframeInterval = int64(max(1, envInt("REPLAY_KEYFRAME_INTERVAL", 10)))
+
+// Replay entry types
+const (
+	replayInput    = "input"
+	replayKeyframe = "keyframe"
+	replayJoin     = "join"
+	replayLeave    = "leave"
+	replayTakeover = "takeover"
+)
+
+// replayHeader is the first line of a replay and describes the game it was recorded from.
+type replayHeader struct {
+	GameID         string         `json:"gameId"`
+	Mode           *GameMode      `json:"mode"`
+	Region         string         `json:"region"`
+	Seed           int64          `json:"seed"`
+	TickIntervalMs int64          `json:"tickIntervalMs"`
+	StartedAt      time.Time      `json:"startedAt"`
+	Players        []replayPlayer `json:"players"`
+}
+
+type replayPlayer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Team  int    `json:"team"`
+	IsBot bool   `json:"isBot"`
+}
+
+func newReplayPlayer(player *Player) replayPlayer {
+	return replayPlayer{ID: player.ID, Name: player.Name, Team: player.Team, IsBot: player.IsBot}
+}
+
+// replayEntry is an accepted input, a state keyframe or a change of the players, stamped with the
+// game tick it happened on.
+type replayEntry struct {
+	Tick     int64                  `json:"tick"`
+	Type     string                 `json:"type"`
+	PlayerID string                 `json:"playerId,omitempty"`
+	Input    json.RawMessage        `json:"input,omitempty"`
+	State    map[string]interface{} `json:"state,omitempty"`
+	// The player who joined or took over a slot
+	Player *replayPlayer `json:"player,omitempty"`
+}
+
+// replayRecorder writes a replay as gzipped JSON lines, the header followed by the entries.
+// It is only used by the game's goroutine.
+type replayRecorder struct {
+	buf bytes.Buffer
+	gz  *gzip.Writer
+	enc *json.Encoder
+	// Logger of the recorded game
+	logger *slog.Logger
+}
+
+// newReplayRecorder starts the replay of a game that is starting, or returns nil when replays
+// aren't recorded. Must be called before the game runs.
+func newReplayRecorder(game *Game) *replayRecorder {
+	if !recordReplays {
+		return nil
+	}
+	r := &replayRecorder{logger: game.logger}
+	r.gz = gzip.NewWriter(&r.buf)
+	r.enc = json.NewEncoder(r.gz)
+
+	header := replayHeader{
+		GameID:         game.ID,
+		Mode:           gameModes[game.Mode],
+		Region:         game.Region,
+		Seed:           game.Seed,
+		TickIntervalMs: tickInterval.Milliseconds(),
+		StartedAt:      game.StartedAt,
+		Players:        []replayPlayer{},
+	}
+	for _, player := range game.Players {
+		header.Players = append(header.Players, newReplayPlayer(player))
+	}
+	if err := r.enc.Encode(header); err != nil {
+		game.logger.Error("Error recording replay", "error", err)
+	}
+	return r
+}
+
+func (r *replayRecorder) record(entry replayEntry) {
+	if r == nil {
+		return
+	}
+	if err := r.enc.Encode(entry); err != nil {
+		r.logger.Error("Error recording replay entry", "error", err)
+	}
+}
+
+// recordInput adds an accepted input of the player to the replay of their game.
+func (r *replayRecorder) recordInput(tick int64, player *Player, data []byte) {
+	r.record(replayEntry{Tick: tick, Type: replayInput, PlayerID: player.ID, Input: data})
+}
+
+// recordJoin adds a player who joined the game in progress. Their spawn draws from the game's
+// random source, so joins must be replayed on the same tick and in the same order.
+func (r *replayRecorder) recordJoin(tick int64, player *Player) {
+	joined := newReplayPlayer(player)
+	r.record(replayEntry{Tick: tick, Type: replayJoin, PlayerID: player.ID, Player: &joined})
+}
+
+// recordLeave adds a player whose slot was released.
+func (r *replayRecorder) recordLeave(tick int64, player *Player) {
+	r.record(replayEntry{Tick: tick, Type: replayLeave, PlayerID: player.ID})
+}
+
+// recordTakeover adds a new session of the player taking over the slot held by previous.
+func (r *replayRecorder) recordTakeover(tick int64, previous, player *Player) {
+	session := newReplayPlayer(player)
+	r.record(replayEntry{Tick: tick, Type: replayTakeover, PlayerID: previous.ID, Player: &session})
+}
+
+// recordKeyframe adds the state of the game at the tick.
+func (r *replayRecorder) recordKeyframe(tick int64, state map[string]interface{}) {
+	r.record(replayEntry{Tick: tick, Type: replayKeyframe, State: state})
+}
+
+// finish flushes the replay and returns the compressed stream.
+func (r *replayRecorder) finish() ([]byte, error) {
+	if err := r.gz.Close(); err != nil {
+		return nil, err
+	}
+	return r.buf.Bytes(), nil
+}
+
+// storeReplay finishes the replay of a game that is closing and stores it.
+// Must be called on the game's goroutine.
+func (s *Server) storeReplay(game *Game) {
+	data, err := game.Replay.finish()
+	if err != nil {
+		game.logger.Error("Error finishing replay", "error", err)
+		return
+	}
+	if err := s.db.StoreReplay(game.ID, data, s.clock.Now()); err != nil {
+		game.logger.Error("Error storing replay", "error", err)
+	}
+}
+
+// GetReplayHandler downloads the gzipped JSON lines replay of a finished game.
+func (s *Server) GetReplayHandler(w http.ResponseWriter, r *http.Request) {
+	gameId := mux.Vars(r)["gameId"]
+	data, err := s.db.GetReplay(gameId)
+	if errors.Is(err, database.ErrReplayNotFound) {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+gameId+`.replay.gz"`)
+	w.Write(data)
+}
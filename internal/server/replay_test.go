@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// replayEntries decodes every entry of a finished replay, skipping the header.
+func replayEntries(t *testing.T, data []byte) []replayEntry {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	dec := json.NewDecoder(gz)
+	var header replayHeader
+	if err := dec.Decode(&header); err != nil {
+		t.Fatalf("decoding header: %v", err)
+	}
+	entries := []replayEntry{}
+	for {
+		var entry replayEntry
+		err := dec.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("decoding entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestReplayRecordsPlayerChanges(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+	starter := newTestPlayer(s, "starter")
+	game := &Game{
+		ID:        "game",
+		Mode:      defaultMode,
+		Players:   []*Player{starter},
+		OpenSlots: 1,
+		Rand:      newGameRand(1),
+		logger:    slog.Default(),
+	}
+	game.Replay = newReplayRecorder(game)
+
+	game.Tick = 5
+	joiner := newTestPlayer(s, "joiner")
+	if !s.joinGame(game, joiner) {
+		t.Fatal("joinGame failed")
+	}
+	game.Tick = 8
+	if !s.takeOverSlot(game, joiner, newTestPlayer(s, "joiner")) {
+		t.Fatal("takeOverSlot failed")
+	}
+	game.Tick = 13
+	starter.Disconnected, starter.DisconnectedAt = true, clock.Now()
+	releaseDisconnectedSlots(game, clock.Now().Add(disconnectGracePeriod+1))
+
+	data, err := game.Replay.finish()
+	if err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	entries := replayEntries(t, data)
+	want := []struct {
+		tick     int64
+		kind     string
+		playerId string
+	}{
+		{5, replayJoin, "joiner"},
+		{8, replayTakeover, "joiner"},
+		{13, replayLeave, "starter"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("recorded %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		if e := entries[i]; e.Tick != w.tick || e.Type != w.kind || e.PlayerID != w.playerId {
+			t.Fatalf("entry %d is %s of %s at tick %d, want %s of %s at tick %d", i, e.Type, e.PlayerID, e.Tick, w.kind, w.playerId, w.tick)
+		}
+	}
+	if entries[0].Player == nil || entries[0].Player.Team != joiner.Team {
+		t.Fatalf("join entry doesn't record the joining player: %+v", entries[0].Player)
+	}
+}
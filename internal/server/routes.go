@@ -2,17 +2,50 @@ package server
 
 import (
 	"github.com/gorilla/mux"
+	"log/slog"
 	"net/http"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := mux.NewRouter()
+	r.Use(withRequestID)
 	r.HandleFunc("/", s.helloHandler)
 	r.HandleFunc("/ws", s.PlayerConnect)
+	r.HandleFunc("/lobby", s.LobbyConnect)
+	r.HandleFunc("/replay/{gameId}", s.ReplayConnect)
+	r.HandleFunc("/spectate/{gameId}", s.SpectateConnect)
 	r.HandleFunc("/close-game/{gameId}", s.CloseGameHandler).Methods("POST")
+	r.HandleFunc("/games/{gameId}/result", s.GetGameResultHandler).Methods("GET")
+	r.HandleFunc("/games/{gameId}/replay", s.GetReplayHandler).Methods("GET")
 	r.HandleFunc("/create-player", s.CreatePlayerHandler).Methods("POST")
+	r.HandleFunc("/players/{playerId}/profile", s.GetProfileHandler).Methods("GET")
+	r.HandleFunc("/leaderboard", s.GetLeaderboardHandler).Methods("GET")
+	r.HandleFunc("/leaderboard/players/{playerId}", s.GetPlayerRankHandler).Methods("GET")
+	r.HandleFunc("/seasons", s.GetSeasonsHandler).Methods("GET")
+	r.HandleFunc("/seasons/{seasonId}/standings", s.GetSeasonStandingsHandler).Methods("GET")
+	r.HandleFunc("/friends", s.GetFriendsHandler).Methods("GET")
+	r.HandleFunc("/friends/request", s.SendFriendRequestHandler).Methods("POST")
+	r.HandleFunc("/friends/accept", s.AcceptFriendRequestHandler).Methods("POST")
+	r.HandleFunc("/friends/remove", s.RemoveFriendHandler).Methods("POST")
+	r.HandleFunc("/friends/block", s.BlockPlayerHandler).Methods("POST")
+	r.HandleFunc("/admin/sanctions", requireAdmin(s.ApplySanctionHandler)).Methods("POST")
+	r.HandleFunc("/admin/sanctions", requireAdmin(s.GetSanctionsHandler)).Methods("GET")
+	r.HandleFunc("/admin/sanctions/{sanctionId}/lift", requireAdmin(s.LiftSanctionHandler)).Methods("POST")
+	r.HandleFunc("/admin/seasons/end", requireAdmin(s.EndSeasonHandler)).Methods("POST")
+	r.HandleFunc("/admin/notify", requireAdmin(s.SystemNotificationHandler)).Methods("POST")
+	r.HandleFunc("/admin/reports", requireAdmin(s.GetReportsHandler)).Methods("GET")
+	r.HandleFunc("/admin/reports/{reportId}/review", requireAdmin(s.ReviewReportHandler)).Methods("POST")
+	r.HandleFunc("/admin/workers", requireAdmin(s.GetWorkersHandler)).Methods("GET")
+	r.HandleFunc("/metrics", s.MetricsHandler).Methods("GET")
+
+	if adminToken == "" {
+		slog.Warn("ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
 
 	go s.Matchmaking()
+	for _, shard := range s.shards {
+		go s.runShard(shard)
+	}
 
 	return r
 }
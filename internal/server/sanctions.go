@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"game-server/internal/database"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Token admin endpoints require as "Authorization: Bearer <token>". Unset disables them.
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+// Close reasons are limited to 123 bytes by the WebSocket protocol
+const maxCloseReasonLength = 123
+
+var sanctionTypes = []string{
+	database.SanctionBan,
+	database.SanctionSuspension,
+	database.SanctionChatMute,
+	database.SanctionMatchmakingCooldown,
+}
+
+type applySanctionRequest struct {
+	PlayerID string `json:"playerId"`
+	Type     string `json:"type"`
+	Reason   string `json:"reason"`
+	IssuedBy string `json:"issuedBy"`
+	// How long the sanction lasts, such as "72h". Empty means permanent.
+	Duration string `json:"duration"`
+}
+
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+adminToken {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) ApplySanctionHandler(w http.ResponseWriter, r *http.Request) {
+	var req applySanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PlayerID == "" {
+		http.Error(w, "Missing playerId", http.StatusBadRequest)
+		return
+	}
+	if !isSanctionType(req.Type) {
+		http.Error(w, "Invalid sanction type", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "Missing reason", http.StatusBadRequest)
+		return
+	}
+	if req.IssuedBy == "" {
+		http.Error(w, "Missing issuedBy", http.StatusBadRequest)
+		return
+	}
+	sanction := database.Sanction{
+		PlayerID: req.PlayerID,
+		Type:     req.Type,
+		Reason:   req.Reason,
+		IssuedBy: req.IssuedBy,
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, "Invalid duration", http.StatusBadRequest)
+			return
+		}
+		expiresAt := s.clock.Now().Add(duration)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	sanctionId, err := s.applySanction(sanction)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"message":    "Sanction applied successfully",
+		"sanctionId": sanctionId,
+	}
+	jsonResponse(w, response, http.StatusCreated)
+}
+
+func (s *Server) LiftSanctionHandler(w http.ResponseWriter, r *http.Request) {
+	sanctionId, err := strconv.ParseInt(mux.Vars(r)["sanctionId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid sanctionId", http.StatusBadRequest)
+		return
+	}
+	err = s.db.LiftSanction(sanctionId, s.clock.Now())
+	if errors.Is(err, database.ErrSanctionNotFound) {
+		http.Error(w, "Sanction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"message":    "Sanction lifted successfully",
+		"sanctionId": sanctionId,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+func (s *Server) GetSanctionsHandler(w http.ResponseWriter, r *http.Request) {
+	playerId := r.URL.Query().Get("playerId")
+	if playerId == "" {
+		http.Error(w, "Missing playerId", http.StatusBadRequest)
+		return
+	}
+	sanctions, err := s.db.GetSanctions(playerId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, sanctions, http.StatusOK)
+}
+
+// applySanction stores the sanction and kicks the player's current session if the sanction
+// keeps them out of the game or the queue. Bans and suspensions also close their lobby connection.
+func (s *Server) applySanction(sanction database.Sanction) (int64, error) {
+	sanction.CreatedAt = s.clock.Now()
+	sanctionId, err := s.db.StoreSanction(sanction)
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Applied sanction", "player_id", sanction.PlayerID, "type", sanction.Type, "reason", sanction.Reason)
+
+	if sanction.Type == database.SanctionBan || sanction.Type == database.SanctionSuspension {
+		s.kickLobbyClient(sanction.PlayerID, sanctionCloseReason(sanction))
+	}
+	player := s.connectedClient(sanction.PlayerID)
+	if player == nil {
+		return sanctionId, nil
+	}
+	s.mu.Lock()
+	queued := player.GameID == ""
+	s.mu.Unlock()
+	switch sanction.Type {
+	case database.SanctionBan, database.SanctionSuspension:
+		kickPlayer(player, sanctionCloseReason(sanction))
+	case database.SanctionMatchmakingCooldown:
+		if queued {
+			kickPlayer(player, sanctionCloseReason(sanction))
+		}
+	}
+	return sanctionId, nil
+}
+
+// activeSanction returns the player's first active sanction of one of the types, or nil.
+// Lookup errors are logged and treated as no sanction so a database hiccup doesn't lock everyone out.
+func (s *Server) activeSanction(playerId string, types ...string) *database.Sanction {
+	sanctions, err := s.db.GetActiveSanctions(playerId, s.clock.Now())
+	if err != nil {
+		slog.Error("Error getting sanctions", "player_id", playerId, "error", err)
+		return nil
+	}
+	for _, sanction := range sanctions {
+		for _, t := range types {
+			if sanction.Type == t {
+				return &sanction
+			}
+		}
+	}
+	return nil
+}
+
+func isSanctionType(t string) bool {
+	for _, sanctionType := range sanctionTypes {
+		if t == sanctionType {
+			return true
+		}
+	}
+	return false
+}
+
+// sanctionCloseReason describes the sanction for the WebSocket close frame sent to the player.
+func sanctionCloseReason(sanction database.Sanction) string {
+	var reason string
+	switch sanction.Type {
+	case database.SanctionBan:
+		reason = "Banned"
+	case database.SanctionSuspension:
+		reason = "Suspended"
+	case database.SanctionChatMute:
+		reason = "Muted"
+	case database.SanctionMatchmakingCooldown:
+		reason = "Matchmaking cooldown"
+	}
+	if sanction.ExpiresAt != nil {
+		reason += " until " + sanction.ExpiresAt.UTC().Format("2006-01-02 15:04 MST")
+	}
+	reason = fmt.Sprintf("%s: %s", reason, sanction.Reason)
+	if len(reason) > maxCloseReasonLength {
+		reason = strings.ToValidUTF8(reason[:maxCloseReasonLength], "")
+	}
+	return reason
+}
+
+// rejectSanctioned closes a just upgraded connection with the sanction as the close reason.
+func rejectSanctioned(logger *slog.Logger, ws *websocket.Conn, sanction *database.Sanction) {
+	logger.Info("Player rejected", "sanction", sanction.Type)
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, sanctionCloseReason(*sanction)))
+	ws.Close()
+}
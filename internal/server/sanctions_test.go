@@ -0,0 +1,157 @@
+package server
+
+import (
+	"game-server/internal/database"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Far from the wall clock, so anything still comparing against SQLite's datetime('now') fails
+var testEpoch = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestServer(t *testing.T, clock Clock) *Server {
+	t.Helper()
+	metrics := newMetrics()
+	db := database.New(filepath.Join(t.TempDir(), "test.db"), metrics.observeQuery)
+	t.Cleanup(func() { db.Close() })
+	return newServer(0, db, clock, metrics)
+}
+
+func TestSanctionExpiresOnServerClock(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+
+	expiresAt := clock.Now().Add(30 * time.Minute)
+	_, err := s.applySanction(database.Sanction{
+		PlayerID:  "player",
+		Type:      database.SanctionMatchmakingCooldown,
+		Reason:    "test",
+		IssuedBy:  "test",
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("applySanction: %v", err)
+	}
+	if s.activeSanction("player", database.SanctionMatchmakingCooldown) == nil {
+		t.Fatal("sanction is not active right after being applied")
+	}
+
+	clock.Advance(29 * time.Minute)
+	if s.activeSanction("player", database.SanctionMatchmakingCooldown) == nil {
+		t.Fatal("sanction is not active before it expires")
+	}
+	clock.Advance(2 * time.Minute)
+	if sanction := s.activeSanction("player", database.SanctionMatchmakingCooldown); sanction != nil {
+		t.Fatalf("sanction is still active after it expired: %+v", sanction)
+	}
+}
+
+func TestLeaverCooldownFollowsServerClock(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+	player := &Player{ID: "leaver", Name: "Leaver", logger: slog.Default()}
+
+	// Only from the second abandon within the leaver window on does leaving cost a cooldown
+	for i, gameId := range []string{"game-1", "game-2"} {
+		game := &Game{ID: gameId, Mode: defaultMode, logger: slog.Default()}
+		if err := s.db.StoreGameParticipant(game.ID, player.ID, player.Name, false, clock.Now()); err != nil {
+			t.Fatalf("StoreGameParticipant: %v", err)
+		}
+		clock.Advance(time.Minute)
+		s.recordAbandon(game, player, clock.Now())
+		active := s.activeSanction(player.ID, database.SanctionMatchmakingCooldown) != nil
+		if want := leaverCooldown(i+1) > 0; active != want {
+			t.Fatalf("after abandon %d cooldown active = %t, want %t", i+1, active, want)
+		}
+	}
+
+	clock.Advance(leaverCooldown(2) + time.Second)
+	if s.activeSanction(player.ID, database.SanctionMatchmakingCooldown) != nil {
+		t.Fatal("cooldown is still active after it expired")
+	}
+}
+
+// dialLobby opens a lobby connection for the player to a test server running LobbyConnect.
+func dialLobby(t *testing.T, s *Server, playerId string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(s.LobbyConnect))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/lobby?ID=" + playerId + "&Name=" + playerId
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing lobby: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// expectPolicyClose reads from the socket until it is closed and checks it was closed for a
+// policy violation.
+func expectPolicyClose(t *testing.T, ws *websocket.Conn) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Fatalf("lobby closed with %v, want a policy violation", err)
+		}
+		return
+	}
+}
+
+func TestBannedPlayersAreKeptOutOfTheLobby(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+	ban := database.Sanction{PlayerID: "banned", Type: database.SanctionBan, Reason: "test", IssuedBy: "test"}
+
+	// Connected players are dropped when they are banned
+	ws := dialLobby(t, s, "banned")
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatalf("reading lobby greeting: %v", err)
+	}
+	if _, err := s.applySanction(ban); err != nil {
+		t.Fatalf("applySanction: %v", err)
+	}
+	expectPolicyClose(t, ws)
+
+	// and can't connect again
+	expectPolicyClose(t, dialLobby(t, s, "banned"))
+}
+
+func TestSeasonsFollowServerClock(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+
+	first, err := s.db.CurrentSeason()
+	if err != nil {
+		t.Fatalf("CurrentSeason: %v", err)
+	}
+	if !first.StartedAt.Equal(testEpoch) {
+		t.Fatalf("first season started at %v, want %v", first.StartedAt, testEpoch)
+	}
+	clock.Advance(90 * 24 * time.Hour)
+	next, err := s.db.EndSeason("", seasonResetFactor, clock.Now())
+	if err != nil {
+		t.Fatalf("EndSeason: %v", err)
+	}
+	if !next.StartedAt.Equal(clock.Now()) {
+		t.Fatalf("next season started at %v, want %v", next.StartedAt, clock.Now())
+	}
+	ended, err := s.db.GetSeason(first.ID)
+	if err != nil {
+		t.Fatalf("GetSeason: %v", err)
+	}
+	if ended.EndedAt == nil || !ended.EndedAt.Equal(clock.Now()) {
+		t.Fatalf("first season ended at %v, want %v", ended.EndedAt, clock.Now())
+	}
+}
@@ -3,29 +3,50 @@ package server
 import (
 	"fmt"
 	"game-server/internal/database"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 type Server struct {
-	port    int
-	clients map[*websocket.Conn]bool
-	mutex   sync.Mutex
-	db      database.Service
+	port int
+	// Players waiting to be picked up by matchmaking
+	playerQueue chan *Player
+	// Running games by ID. Each game is owned by its own goroutine, mu only guards this registry,
+	// the players' game IDs, cheatKicks and the chat and party state players keep between games.
+	// It is never held while waiting on a game, and may be held while taking mutex but never the
+	// other way around.
+	activeGames map[string]*Game
+	// When each player ID was kicked for cheating within the ban window
+	cheatKicks map[string][]time.Time
+	// Sessions whose socket dropped during a running game, by player ID. A reconnect takes their
+	// slot back as long as the game still holds it. Guarded by mu.
+	droppedSessions map[string]*Player
+	mu              sync.Mutex
+	// Game workers, empty when every game runs on its own goroutine
+	shards []*gameShard
+
+	clients  map[string]*Player // connected players by ID
+	presence map[string]string  // last presence pushed to friends, by player ID
+	// Lobby connections, parties, private rooms and invites, guarded by mutex
+	lobbyClients  map[string]*LobbyClient
+	parties       map[string]*Party
+	partyByPlayer map[string]string
+	rooms         map[string]*Room
+	invites       map[string]*Invite
+	mutex         sync.Mutex
+	db            database.Service
+	clock         Clock
+	metrics       *Metrics
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	NewServer := &Server{
-		port:    port,
-		clients: make(map[*websocket.Conn]bool),
-		db:      database.New(),
-	}
+	metrics := newMetrics()
+	NewServer := newServer(port, database.New(os.Getenv("DB_URL"), metrics.observeQuery), realClock{}, metrics)
 
 	// Declare Server config
 	server := &http.Server{
@@ -38,3 +59,30 @@ func NewServer() *http.Server {
 
 	return server
 }
+
+// newServer creates a server on its own database, clock and metrics. Servers share no state, so
+// tests can run several in one process, each on a FakeClock.
+func newServer(port int, db database.Service, clock Clock, metrics *Metrics) *Server {
+	if err := db.StartFirstSeason(clock.Now()); err != nil {
+		slog.Error("Error starting the first season", "error", err)
+	}
+	return &Server{
+		port:            port,
+		playerQueue:     make(chan *Player, 100),
+		activeGames:     make(map[string]*Game),
+		cheatKicks:      make(map[string][]time.Time),
+		droppedSessions: make(map[string]*Player),
+		shards:          newGameShards(gameWorkers),
+		clients:         make(map[string]*Player),
+		presence:        make(map[string]string),
+
+		lobbyClients:  make(map[string]*LobbyClient),
+		parties:       make(map[string]*Party),
+		partyByPlayer: make(map[string]string),
+		rooms:         make(map[string]*Room),
+		invites:       make(map[string]*Invite),
+		db:            db,
+		clock:         clock,
+		metrics:       metrics,
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of game workers. With 0 every game runs on its own goroutine, otherwise games are
+// spread over this many workers that each tick all their games in one batch.
+var gameWorkers = max(0, envInt("GAME_WORKERS", 0))
+
+// Commands a worker buffers for all its games before senders have to wait
+const shardCommandBuffer = 4096
+
+// gameShard is a worker goroutine that owns a set of games. It plays the part of runGame for
+// every game placed on it, ticking them together on a single ticker.
+type gameShard struct {
+	id       int
+	commands chan func()
+	// Games on the shard, only touched by its goroutine
+	games []*Game
+	// Players in the shard's games as of its last tick plus the games placed since, for placement
+	players atomic.Int64
+
+	mu    sync.Mutex
+	stats shardStats
+}
+
+// shardStats is how long a shard's batches of ticks take.
+type shardStats struct {
+	ID      int   `json:"id"`
+	Games   int   `json:"games"`
+	Players int   `json:"players"`
+	Ticks   int64 `json:"ticks"`
+	// Batches that took longer than the tick interval
+	Overruns    int64         `json:"overruns"`
+	LastTick    time.Duration `json:"lastTickNs"`
+	AverageTick time.Duration `json:"averageTickNs"`
+	MaxTick     time.Duration `json:"maxTickNs"`
+}
+
+func newGameShards(n int) []*gameShard {
+	shards := []*gameShard{}
+	for i := 0; i < n; i++ {
+		shards = append(shards, &gameShard{
+			id:       i,
+			commands: make(chan func(), shardCommandBuffer),
+			stats:    shardStats{ID: i},
+		})
+	}
+	return shards
+}
+
+// placeGame decides where the game runs: on the worker with the fewest players when games are
+// sharded, otherwise on its own goroutine. Must be called before the game is registered.
+func (s *Server) placeGame(game *Game) {
+	if len(s.shards) == 0 {
+		game.commands = make(chan func(), gameCommandBuffer)
+		return
+	}
+	shard := s.shards[0]
+	for _, other := range s.shards[1:] {
+		if other.players.Load() < shard.players.Load() {
+			shard = other
+		}
+	}
+	shard.players.Add(int64(len(game.Players)))
+	game.shard = shard
+	game.commands = shard.commands
+}
+
+// startGame starts running a placed game.
+func (s *Server) startGame(game *Game) {
+	if game.shard == nil {
+		go s.runGame(game)
+		return
+	}
+	shard := game.shard
+	shard.commands <- func() { shard.games = append(shard.games, game) }
+}
+
+// runShard is a worker's goroutine. Like runGame, it ticks its games, checks them for inactive
+// players and runs the commands sent to them, dropping games once they end.
+func (s *Server) runShard(shard *gameShard) {
+	slog.Info("Game worker started", "worker", shard.id)
+	ticker := s.clock.NewTicker(tickInterval)
+	defer ticker.Stop()
+	inactivity := s.clock.NewTicker(inactivityCheckInterval)
+	defer inactivity.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			start := time.Now()
+			for _, game := range shard.games {
+				if game.EndReason == "" {
+					s.tickGame(game, now)
+				}
+			}
+			shard.removeEnded()
+			shard.recordTick(time.Since(start))
+		case now := <-inactivity.C():
+			for _, game := range shard.games {
+				if game.EndReason == "" {
+					s.checkPlayerInactivity(game, now)
+				}
+			}
+			shard.removeEnded()
+		case command := <-shard.commands:
+			command()
+		}
+	}
+}
+
+// removeEnded drops the games that ended and counts the players left. Must be called on the
+// shard's goroutine.
+func (shard *gameShard) removeEnded() {
+	games := shard.games[:0]
+	players := 0
+	for _, game := range shard.games {
+		if game.EndReason != "" {
+			continue
+		}
+		games = append(games, game)
+		players += len(game.Players)
+	}
+	clear(shard.games[len(games):])
+	shard.games = games
+	shard.players.Store(int64(players))
+}
+
+// recordTick adds a batch of ticks that took d to the shard's stats.
+func (shard *gameShard) recordTick(d time.Duration) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	stats := &shard.stats
+	stats.Ticks++
+	stats.Games = len(shard.games)
+	stats.Players = int(shard.players.Load())
+	stats.LastTick = d
+	stats.MaxTick = max(stats.MaxTick, d)
+	// Exponential moving average over roughly the last 100 ticks
+	if stats.Ticks == 1 {
+		stats.AverageTick = d
+	} else {
+		stats.AverageTick += (d - stats.AverageTick) / 100
+	}
+	if d > tickInterval {
+		stats.Overruns++
+	}
+}
+
+func (shard *gameShard) snapshot() shardStats {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.stats
+}
+
+// GetWorkersHandler returns the load and tick times of each game worker.
+func (s *Server) GetWorkersHandler(w http.ResponseWriter, r *http.Request) {
+	workers := []shardStats{}
+	for _, shard := range s.shards {
+		workers = append(workers, shard.snapshot())
+	}
+	response := map[string]interface{}{
+		"sharded": len(s.shards) > 0,
+		"workers": workers,
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
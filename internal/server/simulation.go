@@ -0,0 +1,75 @@
+package server
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Most ticks the game loop runs at once to catch up after a stall. Time beyond that is dropped
+// so a long stall doesn't turn into a burst of ticks.
+const maxCatchUpTicks = 10
+
+// Most inputs waiting for the next tick per game, further inputs are dropped
+const maxPendingInputs = 1024
+
+// Half the side of the square around the origin players spawn in
+const spawnArea = 50.0
+
+// queuedInput is an input waiting to be applied on the next tick.
+type queuedInput struct {
+	player *Player
+	data   []byte
+}
+
+// simTime is the simulated time of the game's current tick. Game logic uses it instead of the
+// wall clock so a match plays out the same from the same seed and inputs.
+func (g *Game) simTime() time.Time {
+	return g.StartedAt.Add(time.Duration(g.Tick) * tickInterval)
+}
+
+// newGameRand returns the game's random source, seeded from the game's seed.
+func newGameRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// spawn places the player at a random point of the spawn area, drawn from the game's random source.
+// Must be called before the game runs or on its goroutine.
+func (g *Game) spawn(player *Player) {
+	player.X = (g.Rand.Float64()*2 - 1) * spawnArea
+	player.Y = (g.Rand.Float64()*2 - 1) * spawnArea
+}
+
+// queueInput holds an input of a player in the game until the next tick.
+// Must be called on the game's goroutine.
+func (g *Game) queueInput(player *Player, data []byte) {
+	if len(g.pendingInputs) >= maxPendingInputs {
+		g.playerLogger(player).Warn("Input queue is full, dropping input")
+		return
+	}
+	g.pendingInputs = append(g.pendingInputs, queuedInput{player: player, data: data})
+}
+
+// stepGame advances the game by one tick, applying at most one queued input per player in the
+// order they arrived. Later inputs of the same player wait for the following ticks.
+// Must be called on the game's goroutine.
+func (s *Server) stepGame(game *Game) {
+	game.Tick++
+	now := game.simTime()
+	s.queueBotInputs(game)
+
+	applied := make(map[*Player]bool)
+	remaining := []queuedInput{}
+	for _, input := range game.pendingInputs {
+		if applied[input.player] {
+			remaining = append(remaining, input)
+			continue
+		}
+		applied[input.player] = true
+		s.handlePlayerInput(game, input.player, input.data, now)
+	}
+	game.pendingInputs = remaining
+
+	if game.Replay != nil && game.Tick%replayKeyframeInterval == 0 {
+		game.Replay.recordKeyframe(game.Tick, getGameState(game))
+	}
+}
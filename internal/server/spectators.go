@@ -0,0 +1,174 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Most spectators watching a single game
+var maxSpectators = envInt("MAX_SPECTATORS", 100)
+
+// Snapshots buffered per spectator. Snapshots that don't fit are dropped rather than slowing down
+// the tick.
+const spectatorSendSize = 16
+
+const messageTypeSpectating = "spectating"
+
+type spectatorFrame struct {
+	at    time.Time
+	state map[string]interface{}
+}
+
+type spectator struct {
+	ID   string
+	Conn Conn
+	send chan map[string]interface{}
+}
+
+// spectatorHub fans the snapshots of a game out to its spectators, delayed by the mode's
+// spectator delay. The game's goroutine publishes and flushes snapshots as it ticks, and hands
+// them to the spectators' send queues without blocking, so slow spectators never hold up the tick.
+type spectatorHub struct {
+	delay time.Duration
+	// Snapshots held back for the delay, only touched by the game's goroutine
+	queue   []spectatorFrame
+	mu      sync.Mutex
+	viewers map[*spectator]bool
+	closed  bool
+}
+
+func newSpectatorHub(delay time.Duration) *spectatorHub {
+	return &spectatorHub{delay: delay, viewers: make(map[*spectator]bool)}
+}
+
+// publish queues a snapshot taken at now. Must be called on the game's goroutine.
+func (h *spectatorHub) publish(state map[string]interface{}, now time.Time) {
+	h.queue = append(h.queue, spectatorFrame{at: now, state: state})
+}
+
+// flush broadcasts the queued snapshots whose delay has passed by now. Must be called on the
+// game's goroutine.
+func (h *spectatorHub) flush(now time.Time) {
+	sent := 0
+	for sent < len(h.queue) && !h.queue[sent].at.Add(h.delay).After(now) {
+		h.broadcast(h.queue[sent].state)
+		sent++
+	}
+	clear(h.queue[:sent])
+	h.queue = h.queue[sent:]
+}
+
+// close disconnects the spectators once the game is over. Must be called on the game's goroutine.
+func (h *spectatorHub) close() {
+	h.queue = nil
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for viewer := range h.viewers {
+		delete(h.viewers, viewer)
+		close(viewer.send)
+	}
+}
+
+func (h *spectatorHub) broadcast(state map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for viewer := range h.viewers {
+		select {
+		case viewer.send <- state:
+		default:
+		}
+	}
+}
+
+// add registers the spectator unless the game is full or over.
+func (h *spectatorHub) add(viewer *spectator) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || len(h.viewers) >= maxSpectators {
+		return false
+	}
+	h.viewers[viewer] = true
+	return true
+}
+
+func (h *spectatorHub) remove(viewer *spectator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.viewers[viewer] {
+		delete(h.viewers, viewer)
+		close(viewer.send)
+	}
+}
+
+func (h *spectatorHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.viewers)
+}
+
+// SpectateConnect lets anyone watch a public game. Private games can only be watched by the
+// members of their room, identified by the ID query parameter.
+func (s *Server) SpectateConnect(w http.ResponseWriter, r *http.Request) {
+	gameId := mux.Vars(r)["gameId"]
+	userId := r.URL.Query().Get("ID")
+
+	s.mu.Lock()
+	game, ok := s.activeGames[gameId]
+	s.mu.Unlock()
+	var players string
+	if !ok || !game.call(func() { players = playerNames(game.Players) }) {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.RoomID != "" && (userId == "" || !s.roomMember(game.RoomID, userId)) {
+		http.Error(w, "Not allowed to spectate this game", http.StatusForbidden)
+		return
+	}
+	if game.Spectators.count() >= maxSpectators {
+		http.Error(w, "Too many spectators", http.StatusServiceUnavailable)
+		return
+	}
+
+	logger := requestLogger(r).With("game_id", gameId, "mode", game.Mode, "spectator_id", userId)
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("Error upgrading connection", "error", err)
+		return
+	}
+	viewer := &spectator{ID: userId, Conn: s.newConn(ws), send: make(chan map[string]interface{}, spectatorSendSize)}
+	err = viewer.Conn.WriteJSON(map[string]interface{}{
+		"type":    messageTypeSpectating,
+		"gameId":  gameId,
+		"players": players,
+		"delayMs": gameModes[game.Mode].SpectatorDelay.Milliseconds(),
+	})
+	if err != nil || !game.Spectators.add(viewer) {
+		viewer.Conn.Close()
+		return
+	}
+	logger.Info("Spectator is watching game")
+
+	go func() {
+		for state := range viewer.send {
+			if err := viewer.Conn.WriteJSON(state); err != nil {
+				break
+			}
+		}
+		viewer.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Game over"))
+		viewer.Conn.Close()
+	}()
+	go func() {
+		// Spectators don't send anything, reading only notices when they leave
+		for {
+			if _, _, err := viewer.Conn.ReadMessage(); err != nil {
+				game.Spectators.remove(viewer)
+				return
+			}
+		}
+	}()
+}
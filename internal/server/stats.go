@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"game-server/internal/database"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Final message sent to the players of a game before their sockets close
+const messageTypeGameOver = "game_over"
+
+// sideStanding is where one side of a finished game ended up against the others.
+type sideStanding struct {
+	Placement int
+	Beaten    int
+	Tied      int
+}
+
+// playerSides maps the players of a game, and the leavers who didn't come back, to their side:
+// their team, or the player alone in modes without teams.
+// Must be called on the game's goroutine.
+func playerSides(game *Game) map[*Player]int {
+	teams := gameModes[game.Mode].Teams > 1
+	sides := make(map[*Player]int)
+	seen := make(map[string]bool)
+	for i, player := range append(append([]*Player(nil), game.Players...), game.Leavers...) {
+		if seen[player.ID] {
+			continue
+		}
+		seen[player.ID] = true
+		if teams {
+			sides[player] = player.Team
+		} else {
+			sides[player] = i
+		}
+	}
+	return sides
+}
+
+// standingSides returns the sides that still have a player in the game who isn't gone.
+// Must be called on the game's goroutine.
+func standingSides(game *Game, sides map[*Player]int, now time.Time) map[int]bool {
+	standing := make(map[int]bool)
+	for _, player := range game.Players {
+		if !player.gone(now) {
+			standing[sides[player]] = true
+		}
+	}
+	return standing
+}
+
+// gameStandings ranks the sides of a game by score. Sides with the same score share a placement.
+// When the game was forfeited the sides that are no longer standing are placed last.
+// Must be called on the game's goroutine.
+func gameStandings(game *Game, sides map[*Player]int, now time.Time) map[int]sideStanding {
+	scores := make(map[int]int)
+	for player, side := range sides {
+		scores[side] += player.Score
+	}
+	if game.EndReason == database.EndForfeit {
+		standing := standingSides(game, sides, now)
+		for side := range scores {
+			if !standing[side] {
+				scores[side] = -1
+			}
+		}
+	}
+	standings := make(map[int]sideStanding)
+	for side, score := range scores {
+		standing := sideStanding{Placement: 1}
+		for other, otherScore := range scores {
+			switch {
+			case other == side:
+			case otherScore > score:
+				standing.Placement++
+			case otherScore == score:
+				standing.Tied++
+			default:
+				standing.Beaten++
+			}
+		}
+		standings[side] = standing
+	}
+	return standings
+}
+
+// buildGameResult ranks the players of a game that is ending. Leavers are placed after everyone
+// who stayed. A game where the top sides tie has no winner.
+// Must be called on the game's goroutine.
+func buildGameResult(game *Game, reason string, now time.Time) *database.GameResult {
+	result := &database.GameResult{
+		GameID:    game.ID,
+		Mode:      game.Mode,
+		EndReason: reason,
+		Players:   []database.PlayerStanding{},
+		EndedAt:   now,
+	}
+	sides := playerSides(game)
+	standings := gameStandings(game, sides, now)
+	last := 1
+	for _, player := range game.Players {
+		side := sides[player]
+		standing := standings[side]
+		result.Players = append(result.Players, playerStanding(player, standing.Placement))
+		last = max(last, standing.Placement+1)
+		if standing.Placement == 1 && standing.Tied == 0 && standing.Beaten > 0 {
+			if gameModes[game.Mode].Teams > 1 {
+				result.WinnerTeam = &side
+			} else {
+				result.WinnerID = player.ID
+			}
+		}
+	}
+	for _, leaver := range game.Leavers {
+		if _, ok := sides[leaver]; !ok {
+			continue
+		}
+		standing := playerStanding(leaver, last)
+		standing.Abandoned = true
+		result.Players = append(result.Players, standing)
+	}
+	sort.SliceStable(result.Players, func(i, j int) bool {
+		return result.Players[i].Placement < result.Players[j].Placement
+	})
+	return result
+}
+
+func playerStanding(player *Player, placement int) database.PlayerStanding {
+	return database.PlayerStanding{
+		PlayerID:  player.ID,
+		Name:      player.Name,
+		IsBot:     player.IsBot,
+		Team:      player.Team,
+		Score:     player.Score,
+		Kills:     player.Kills,
+		Deaths:    player.Deaths,
+		Placement: placement,
+	}
+}
+
+// statsResults returns the results that count towards the lifetime stats: those of the humans who
+// stayed to the end. Abandons are counted from the game's participants.
+func statsResults(result *database.GameResult) []database.PlayerResult {
+	results := []database.PlayerResult{}
+	for _, standing := range result.Players {
+		if standing.IsBot || standing.Abandoned {
+			continue
+		}
+		won := result.WinnerID == standing.PlayerID || (result.WinnerTeam != nil && *result.WinnerTeam == standing.Team)
+		results = append(results, database.PlayerResult{
+			PlayerID:  standing.PlayerID,
+			Placement: standing.Placement,
+			Won:       won,
+			Lost:      standing.Placement > 1,
+		})
+	}
+	return results
+}
+
+func (s *Server) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+	profile, err := s.db.GetPlayerProfile(playerId)
+	if errors.Is(err, database.ErrPlayerNotFound) {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, profile, http.StatusOK)
+}
+
+func (s *Server) GetGameResultHandler(w http.ResponseWriter, r *http.Request) {
+	gameId := mux.Vars(r)["gameId"]
+	result, err := s.db.GetGameResult(gameId)
+	if errors.Is(err, database.ErrGameResultNotFound) {
+		http.Error(w, "Game result not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, result, http.StatusOK)
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"game-server/internal/database"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Distance a player moves with one directional move
+	moveStep = 1.0
+	// Fastest a player can legitimately move, in units per second
+	maxMoveSpeed = 10.0
+	// Extra distance allowed on top of maxMoveSpeed to absorb network jitter
+	moveTolerance = 2.0
+	// Any jump further than this is treated as a teleport
+	teleportDistance = 25.0
+)
+
+// A player's violation score is kept per game and decays by violationDecay points a minute, so
+// the occasional flag from network jitter never adds up. Reaching the kick threshold disconnects
+// the player. Being kicked violationBanKicks times within violationBanWindow also suspends them
+// for violationBanDuration.
+var (
+	violationKickThreshold = envFloat("VIOLATION_KICK_THRESHOLD", 20)
+	violationDecay         = envFloat("VIOLATION_DECAY_PER_MINUTE", 5)
+	violationBanKicks      = envInt("VIOLATION_BAN_KICKS", 3)
+	violationBanWindow     = envDuration("VIOLATION_BAN_WINDOW", 24*time.Hour)
+	violationBanDuration   = envDuration("VIOLATION_BAN_DURATION", 24*time.Hour)
+)
+
+// Weight each kind of violation adds to a player's score
+const (
+	malformedInputViolation = 1
+	rateLimitViolation      = 1
+	cooldownViolation       = 1
+	speedViolation          = 3
+	teleportViolation       = 5
+)
+
+var directions = []string{"north", "south", "east", "west"}
+
+type PlayerInput struct {
+	Action    string   `json:"action"`
+	Direction string   `json:"direction,omitempty"`
+	X         *float64 `json:"x,omitempty"`
+	Y         *float64 `json:"y,omitempty"`
+	Target    string   `json:"target,omitempty"`
+	Timestamp string   `json:"timestamp,omitempty"`
+}
+
+type actionRule struct {
+	// Validate checks the action specific fields of the input
+	Validate func(input PlayerInput) error
+	// Most inputs of this action accepted per second
+	RateLimit int
+	// Minimum time between two inputs of this action
+	Cooldown time.Duration
+}
+
+var actionRules = map[string]actionRule{
+	"move": {
+		Validate: func(input PlayerInput) error {
+			if (input.X == nil) != (input.Y == nil) {
+				return fmt.Errorf("move needs both x and y")
+			}
+			if input.X == nil && !slices.Contains(directions, input.Direction) {
+				return fmt.Errorf("invalid direction %q", input.Direction)
+			}
+			return nil
+		},
+		RateLimit: 20,
+	},
+	"attack": {
+		Validate: func(input PlayerInput) error {
+			if input.Target == "" {
+				return fmt.Errorf("attack needs a target")
+			}
+			return nil
+		},
+		RateLimit: 5,
+		Cooldown:  500 * time.Millisecond,
+	},
+	"jump": {
+		Validate:  func(input PlayerInput) error { return nil },
+		RateLimit: 2,
+		Cooldown:  time.Second,
+	},
+}
+
+// handlePlayerInput validates an input against the action rules and the authoritative game state
+// and applies it. Rejected inputs count towards the player's violation score.
+// Must be called on the game's goroutine.
+func (s *Server) handlePlayerInput(game *Game, player *Player, data []byte, now time.Time) {
+	var input PlayerInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		s.recordViolation(game, player, malformedInputViolation, "malformed input", now)
+		return
+	}
+	rule, ok := actionRules[input.Action]
+	if !ok {
+		s.recordViolation(game, player, malformedInputViolation, fmt.Sprintf("unknown action %q", input.Action), now)
+		return
+	}
+	if err := rule.Validate(input); err != nil {
+		s.recordViolation(game, player, malformedInputViolation, err.Error(), now)
+		return
+	}
+
+	if player.actionTimes == nil {
+		player.actionTimes = make(map[string][]time.Time)
+	}
+	// Only the inputs of the last second count towards the rate limit
+	recent := []time.Time{}
+	for _, t := range player.actionTimes[input.Action] {
+		if now.Sub(t) < time.Second {
+			recent = append(recent, t)
+		}
+	}
+	player.actionTimes[input.Action] = recent
+	if len(recent) >= rule.RateLimit {
+		s.recordViolation(game, player, rateLimitViolation, fmt.Sprintf("%s rate limit exceeded", input.Action), now)
+		return
+	}
+	if last, ok := player.lastActionAt[input.Action]; ok && now.Sub(last) < rule.Cooldown {
+		s.recordViolation(game, player, cooldownViolation, fmt.Sprintf("%s on cooldown", input.Action), now)
+		return
+	}
+	player.actionTimes[input.Action] = append(recent, now)
+	if player.lastActionAt == nil {
+		player.lastActionAt = make(map[string]time.Time)
+	}
+	player.lastActionAt[input.Action] = now
+	game.Replay.recordInput(game.Tick, player, data)
+
+	switch input.Action {
+	case "move":
+		s.applyMove(game, player, input, now)
+	case "attack":
+		applyAttack(game, player, input)
+	}
+}
+
+// applyMove moves the player, rejecting moves faster than the player can legitimately travel.
+// Must be called on the game's goroutine.
+func (s *Server) applyMove(game *Game, player *Player, input PlayerInput, now time.Time) {
+	x, y := player.X, player.Y
+	if input.X != nil {
+		x, y = *input.X, *input.Y
+	} else {
+		switch input.Direction {
+		case "north":
+			y += moveStep
+		case "south":
+			y -= moveStep
+		case "east":
+			x += moveStep
+		case "west":
+			x -= moveStep
+		}
+	}
+
+	distance := math.Hypot(x-player.X, y-player.Y)
+	if distance > teleportDistance {
+		s.recordViolation(game, player, teleportViolation, fmt.Sprintf("teleported %.1f units", distance), now)
+		return
+	}
+	if !player.LastMoveAt.IsZero() {
+		allowed := maxMoveSpeed*now.Sub(player.LastMoveAt).Seconds() + moveTolerance
+		if distance > allowed {
+			s.recordViolation(game, player, speedViolation, fmt.Sprintf("moved %.1f units, at most %.1f allowed", distance, allowed), now)
+			return
+		}
+	}
+	player.X, player.Y = x, y
+	player.LastMoveAt = now
+}
+
+// recordViolation adds to the player's decayed violation score and kicks them once it reaches the
+// kick threshold, suspending players that keep getting kicked. Inputs still queued from a session
+// that was kicked are ignored. Must be called on the game's goroutine.
+func (s *Server) recordViolation(game *Game, player *Player, weight int, reason string, now time.Time) {
+	if player.kicked {
+		return
+	}
+	if !player.violationAt.IsZero() {
+		decayed := now.Sub(player.violationAt).Minutes() * violationDecay
+		player.violationScore = max(0, player.violationScore-decayed)
+	}
+	player.violationScore += float64(weight)
+	player.violationAt = now
+	logger := game.playerLogger(player)
+	logger.Info("Player input rejected", "reason", reason, "violation_score", player.violationScore)
+	if player.violationScore < violationKickThreshold {
+		return
+	}
+
+	player.kicked = true
+	s.mu.Lock()
+	kicks := []time.Time{}
+	for _, at := range s.cheatKicks[player.ID] {
+		if now.Sub(at) < violationBanWindow {
+			kicks = append(kicks, at)
+		}
+	}
+	kicks = append(kicks, now)
+	s.cheatKicks[player.ID] = kicks
+	s.mu.Unlock()
+
+	if len(kicks) >= violationBanKicks {
+		expiresAt := now.Add(violationBanDuration)
+		sanction := database.Sanction{
+			PlayerID:  player.ID,
+			CreatedAt: now,
+			Type:      database.SanctionSuspension,
+			Reason:    "Cheating detected",
+			IssuedBy:  "anti-cheat",
+			ExpiresAt: &expiresAt,
+		}
+		if _, err := s.db.StoreSanction(sanction); err != nil {
+			logger.Error("Error storing sanction", "error", err)
+		}
+		logger.Info("Player suspended for cheating", "kicks", len(kicks))
+		s.kickLobbyClient(player.ID, sanctionCloseReason(sanction))
+		kickPlayer(player, sanctionCloseReason(sanction))
+		return
+	}
+	logger.Info("Player kicked for cheating", "kicks", len(kicks))
+	kickPlayer(player, "Kicked for cheating")
+}
+
+func kickPlayer(player *Player, reason string) {
+	player.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+	player.Conn.Close()
+}
+
+// applyAttack scores a point and a kill for the player when the target is an opponent in their game.
+// Must be called on the game's goroutine.
+func applyAttack(game *Game, player *Player, input PlayerInput) {
+	for _, target := range game.Players {
+		if target.ID == input.Target && target.Team != player.Team {
+			player.Score++
+			player.Kills++
+			target.Deaths++
+			return
+		}
+	}
+}
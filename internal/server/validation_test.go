@@ -0,0 +1,52 @@
+package server
+
+import (
+	"game-server/internal/database"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestPlayer(s *Server, id string) *Player {
+	return &Player{ID: id, Name: id, Conn: newBotConn(), logger: slog.Default()}
+}
+
+func TestOccasionalViolationsDecay(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+	game := &Game{ID: "game", Mode: defaultMode, logger: slog.Default()}
+	player := newTestPlayer(s, "jittery")
+
+	// A speed flag every minute is well within what the decay absorbs
+	for i := 0; i < 50; i++ {
+		s.recordViolation(game, player, speedViolation, "jitter", clock.Now())
+		clock.Advance(time.Minute)
+	}
+	if player.kicked {
+		t.Fatalf("player was kicked for occasional violations, score %.1f", player.violationScore)
+	}
+}
+
+func TestRepeatedKicksSuspend(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	s := newTestServer(t, clock)
+	game := &Game{ID: "game", Mode: defaultMode, logger: slog.Default()}
+
+	for kick := 1; kick <= violationBanKicks; kick++ {
+		// Every game starts with a new session and a clean score
+		player := newTestPlayer(s, "cheater")
+		for !player.kicked {
+			s.recordViolation(game, player, teleportViolation, "teleport", clock.Now())
+		}
+		// Inputs still queued from the kicked session don't count again
+		s.recordViolation(game, player, teleportViolation, "teleport", clock.Now())
+		if got := len(s.cheatKicks[player.ID]); got != kick {
+			t.Fatalf("recorded %d kicks, want %d", got, kick)
+		}
+		suspended := s.activeSanction(player.ID, database.SanctionSuspension) != nil
+		if want := kick == violationBanKicks; suspended != want {
+			t.Fatalf("after kick %d suspended = %t, want %t", kick, suspended, want)
+		}
+		clock.Advance(time.Hour)
+	}
+}